@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"luxor.tech/tcp_msg_processing_test/internal/accounting"
+	"luxor.tech/tcp_msg_processing_test/internal/stats"
+	"luxor.tech/tcp_msg_processing_test/pkg/logger"
+	rds_db "luxor.tech/tcp_msg_processing_test/rds-db"
+)
+
+const usage = `usage: accounting [flags] block <ref> <reward> | period <rate> | balances [username] | ledger [username]
+  block <ref> <reward>  credit a found block among the last -n shares before -at (PPLNS)
+  period <rate>         credit rate per share accepted in [-from, -to) (PPS)
+  balances [username]   credited balance of every user, or of one
+  ledger [username]     latest -limit ledger entries
+amounts are in the smallest currency unit
+flags:`
+
+type options struct {
+	dbConfigFile string
+	from, to, at string
+	n            int64
+	limit        int
+	asJSON       bool
+}
+
+// main payout calculation and balances
+func main() {
+	var opts options
+	flag.StringVar(&opts.dbConfigFile, "db-config", "config/db_config.json", "database config file, $DATABASE_URL overrides the dsn")
+	flag.StringVar(&opts.from, "from", "", "period start, RFC3339, defaults to 24h before -to")
+	flag.StringVar(&opts.to, "to", "", "period end (exclusive), RFC3339, defaults to now")
+	flag.StringVar(&opts.at, "at", "", "block time, RFC3339, defaults to now")
+	flag.Int64Var(&opts.n, "n", 1_000_000, "PPLNS window in shares")
+	flag.IntVar(&opts.limit, "limit", 100, "number of ledger entries")
+	flag.BoolVar(&opts.asJSON, "json", false, "print JSON")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if err := run(opts); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
+
+func run(opts options) error {
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// keep stdout for results
+	l, _ := logger.NewLogger(os.Stderr, logger.Config{LogLevel: "warn"})
+	logger.SetDefault(l)
+	dbConfig, err := rds_db.LoadConfig(opts.dbConfigFile)
+	if err != nil {
+		return err
+	}
+	dbConfig.ConnectRetries, dbConfig.HealthCheckInterval = 1, 0
+	if err := rds_db.Init(dbConfig); err != nil {
+		return err
+	}
+	db, err := rds_db.GetDb()
+	if err != nil {
+		return err
+	}
+	ledger := accounting.NewLedger(db)
+	ctx := context.Background()
+
+	var result interface{}
+	var rows [][]interface{}
+	switch flag.Arg(0) {
+	case "block":
+		if flag.NArg() < 3 {
+			return fmt.Errorf("ref and reward required")
+		}
+		reward, err := strconv.ParseInt(flag.Arg(2), 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid reward: %v", err)
+		}
+		at := time.Now()
+		if opts.at != "" {
+			if at, err = time.Parse(time.RFC3339, opts.at); err != nil {
+				return fmt.Errorf("invalid at: %v", err)
+			}
+		}
+		round, err := ledger.CreditBlock(ctx, flag.Arg(1), reward, opts.n, at)
+		if err != nil {
+			return err
+		}
+		result, rows = round, creditRows(round)
+	case "period":
+		if flag.NArg() < 2 {
+			return fmt.Errorf("rate required")
+		}
+		rate, err := strconv.ParseInt(flag.Arg(1), 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid rate: %v", err)
+		}
+		from, to, err := stats.ParseWindow(opts.from, opts.to, time.Now())
+		if err != nil {
+			return err
+		}
+		round, err := ledger.CreditPeriod(ctx, from, to, rate)
+		if err != nil {
+			return err
+		}
+		result, rows = round, creditRows(round)
+	case "balances":
+		var balances []accounting.Balance
+		if flag.NArg() > 1 {
+			balance, err := ledger.Balance(ctx, flag.Arg(1))
+			if err != nil {
+				return err
+			}
+			balances = []accounting.Balance{balance}
+		} else if balances, err = ledger.Balances(ctx); err != nil {
+			return err
+		}
+		result, rows = balances, [][]interface{}{{"USERNAME", "SHARES", "AMOUNT"}}
+		for _, b := range balances {
+			rows = append(rows, []interface{}{b.Username, b.Shares, b.Amount})
+		}
+	case "ledger":
+		entries, err := ledger.Entries(ctx, flag.Arg(1), opts.limit)
+		if err != nil {
+			return err
+		}
+		result, rows = entries, [][]interface{}{{"ID", "ROUND", "USERNAME", "SHARES", "AMOUNT", "CREATED"}}
+		for _, e := range entries {
+			rows = append(rows, []interface{}{e.ID, e.Ref, e.Username, e.Shares, e.Amount, e.CreatedAt.Format(time.RFC3339)})
+		}
+	default:
+		return fmt.Errorf("unknown command: %s", flag.Arg(0))
+	}
+
+	if opts.asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(result)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, row := range rows {
+		for i, col := range row {
+			if i > 0 {
+				fmt.Fprint(tw, "\t")
+			}
+			fmt.Fprint(tw, col)
+		}
+		fmt.Fprintln(tw)
+	}
+	return tw.Flush()
+}
+
+func creditRows(round accounting.Round) [][]interface{} {
+	rows := [][]interface{}{{"USERNAME", "SHARES", "AMOUNT"}}
+	for _, c := range round.Credits {
+		rows = append(rows, []interface{}{c.Username, c.Shares, c.Amount})
+	}
+	return append(rows, []interface{}{"TOTAL " + round.Ref, round.Shares, round.Reward})
+}
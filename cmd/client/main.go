@@ -2,27 +2,57 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"os"
 	"time"
 
 	"luxor.tech/tcp_msg_processing_test/internal/client"
 	"luxor.tech/tcp_msg_processing_test/pkg/logger"
+	"luxor.tech/tcp_msg_processing_test/pkg/metrics"
 )
 
 func main() {
+	serverAddr := flag.String("addr", "localhost:8888", "server address")
+	username := flag.String("user", "test_user", "username") // todo generate username
+	metricsAddr := flag.String("metrics-addr", "", "prometheus "+metrics.Path+" listen address, disabled when empty")
+	wsURL := flag.String("ws", "", "connect over websocket, e.g. ws://localhost:8889/ws")
+	tlsEnable := flag.Bool("tls", false, "dial the server over tls")
+	tlsCA := flag.String("tls-ca", "", "CA bundle verifying the server, system roots when empty")
+	tlsServerName := flag.String("tls-server-name", "", "expected server name")
+	tlsCert := flag.String("tls-cert", "", "client certificate file")
+	tlsKey := flag.String("tls-key", "", "client private key file")
+	tlsInsecure := flag.Bool("tls-insecure", false, "skip server certificate verification, lab use only")
+	flag.Parse()
+
 	// Initialize logger
 	err := logger.InitLogger("config/log_config_client.json")
 	if err != nil {
 		panic("Failed to initialize logger: " + err.Error())
 	}
+	defer logger.Close()
+	go logger.HandleLevelSignals()
 
-	// Server address and username
-	serverAddr := "localhost:8888"
-	username := "test_user" // todo generate username
+	if *metricsAddr != "" {
+		go func() {
+			if err := metrics.Serve(*metricsAddr); err != nil {
+				logger.Error("Metrics server stopped: %v", err)
+			}
+		}()
+	}
 
 	// Create a new client
-	cli := client.NewClient(serverAddr, username, time.Second, time.Minute)
+	cli := client.NewClient(*serverAddr, *username, time.Second, time.Minute)
+	cli.SetWebSocket(*wsURL)
+	if *tlsEnable {
+		cli.SetTLS(&client.TLSConfig{
+			CAFile:             *tlsCA,
+			ServerName:         *tlsServerName,
+			CertFile:           *tlsCert,
+			KeyFile:            *tlsKey,
+			InsecureSkipVerify: *tlsInsecure,
+		})
+	}
 
 	// Connect to the server
 	err = cli.Connect()
@@ -43,6 +73,7 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	go cli.StartAutoSubmission(ctx)
+	go cli.StartKeepalive(ctx)
 
 	// Start deal tasks
 	cli.ReceiveTasks(ctx)
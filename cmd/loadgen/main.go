@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"luxor.tech/tcp_msg_processing_test/internal/loadgen"
+	"luxor.tech/tcp_msg_processing_test/pkg/logger"
+)
+
+// main simulate many miners against a server and report how it held up
+func main() {
+	cfg := loadgen.DefaultConfig()
+	flag.StringVar(&cfg.Addr, "addr", cfg.Addr, "server address")
+	flag.IntVar(&cfg.Clients, "clients", cfg.Clients, "simulated clients")
+	flag.DurationVar(&cfg.Ramp, "ramp", cfg.Ramp, "period over which clients connect")
+	flag.DurationVar(&cfg.Duration, "duration", cfg.Duration, "whole run including the ramp")
+	flag.Float64Var(&cfg.Rate, "rate", cfg.Rate, "shares per second of each paced client")
+	flag.Float64Var(&cfg.Invalid, "invalid", 0, "fraction of shares with a wrong result")
+	flag.Float64Var(&cfg.Duplicate, "duplicate", 0, "fraction of shares resubmitting the previous nonce")
+	flag.Float64Var(&cfg.Flooders, "flooders", 0, "fraction of clients submitting back to back")
+	flag.StringVar(&cfg.UserPrefix, "user-prefix", cfg.UserPrefix, "usernames are <prefix>-<n>")
+	flag.DurationVar(&cfg.JobWait, "job-wait", cfg.JobWait, "time a client waits for its first job")
+	flag.StringVar(&cfg.AdminURL, "admin-url", "", "server admin api, e.g. http://localhost:8890, sends each client a job right after authorize")
+	flag.StringVar(&cfg.AdminToken, "admin-token", os.Getenv("ADMIN_TOKEN"), "admin api bearer token, defaults to $ADMIN_TOKEN")
+	flag.StringVar(&cfg.MetricsURL, "server-metrics", "", "server metrics url, e.g. http://localhost:9100/metrics, reports resource usage")
+	format := flag.String("format", "json", "report format: json|csv")
+	out := flag.String("out", "", "report file, stdout when empty")
+	flag.Parse()
+	if *format != "json" && *format != "csv" {
+		fmt.Fprintln(os.Stderr, "Error: unknown format:", *format)
+		os.Exit(2)
+	}
+
+	// keep stdout for the report
+	l, _ := logger.NewLogger(os.Stderr, logger.Config{LogLevel: "error"})
+	logger.SetDefault(l)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+	report, err := loadgen.Run(ctx, cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+
+	w := os.Stdout
+	if *out != "" {
+		if w, err = os.Create(*out); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		defer w.Close()
+	}
+	if err := report.Write(w, *format); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
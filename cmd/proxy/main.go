@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+
+	"luxor.tech/tcp_msg_processing_test/internal/admin"
+	"luxor.tech/tcp_msg_processing_test/internal/proxy"
+	"luxor.tech/tcp_msg_processing_test/internal/server"
+	"luxor.tech/tcp_msg_processing_test/pkg/logger"
+	"luxor.tech/tcp_msg_processing_test/pkg/metrics"
+)
+
+// main serve downstream sessions on the jobs of one upstream pool session
+func main() {
+	defaults := proxy.DefaultConfig()
+	addr := flag.String("addr", ":8889", "downstream listen address")
+	upstream := flag.String("upstream", "localhost:8888", "upstream pool address")
+	username := flag.String("username", "", "upstream username, forwarded shares are credited to it")
+	forwardZeros := flag.Int("forward-zeros", defaults.ForwardZeros, "leading zero hex digits a share result needs to be forwarded upstream")
+	forwardInterval := flag.Duration("forward-interval", defaults.ForwardInterval, "shortest time between forwarded shares, the upstream rate limit")
+	reconnectDelay := flag.Duration("reconnect-delay", defaults.ReconnectDelay, "wait before reconnecting a lost upstream")
+	extranonceSize := flag.Int("extranonce-size", server.DefaultConfig().ExtranonceSize, "bytes of the downstream extranonce appended to the upstream one")
+	metricsAddr := flag.String("metrics-addr", "", "prometheus "+metrics.Path+" listen address, disabled when empty")
+	adminAddr := flag.String("admin-addr", "", "admin http api listen address, disabled when empty")
+	adminToken := flag.String("admin-token", os.Getenv("ADMIN_TOKEN"), "admin api bearer token, defaults to $ADMIN_TOKEN")
+	flag.Parse()
+
+	err := logger.InitLogger("config/log_config.json")
+	if err != nil {
+		panic("Failed to initialize logger: " + err.Error())
+	}
+	defer logger.Close()
+	go logger.HandleLevelSignals()
+
+	cfg := proxy.DefaultConfig()
+	cfg.Upstream = *upstream
+	cfg.Username = *username
+	cfg.ForwardZeros = *forwardZeros
+	cfg.ForwardInterval = *forwardInterval
+	cfg.ReconnectDelay = *reconnectDelay
+	if err := cfg.Validate(); err != nil {
+		panic(err)
+	}
+	p := proxy.NewProxy(cfg)
+	go p.Run(context.Background())
+
+	serverConfig := server.DefaultConfig()
+	serverConfig.ExtranonceSize = *extranonceSize
+	downstream := server.NewServerWithConfig(serverConfig)
+	downstream.SetJobSource(p)
+	downstream.SetShareHandler(p)
+	downstream.SetStore(p)
+
+	if *metricsAddr != "" {
+		go func() {
+			if err := metrics.Serve(*metricsAddr); err != nil {
+				panic(err)
+			}
+		}()
+	}
+	if *adminAddr != "" {
+		go func() {
+			adminAPI := admin.NewAdmin(*adminAddr, *adminToken, downstream)
+			adminAPI.EnableProxy(p)
+			if err := adminAPI.Start(); err != nil {
+				panic(err)
+			}
+		}()
+	}
+	if err := downstream.Start(*addr); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"text/tabwriter"
+	"time"
+
+	"luxor.tech/tcp_msg_processing_test/internal/record"
+)
+
+const usage = `usage: replay [flags] verify <recording> | send <recording>
+  verify <recording>  recompute every submitted result from the recorded jobs and flag answers contradicting it
+  send <recording>    replay the client frames against -addr and compare live answers with the recorded ones
+recordings are written by the server to -record-dir for usernames enabled with POST /recordings
+flags:`
+
+type options struct {
+	addr    string
+	speed   float64
+	rewrite bool
+	wait    time.Duration
+	asJSON  bool
+}
+
+// main verify a traffic recording offline or replay it against a server
+func main() {
+	var opts options
+	defaults := record.DefaultReplayOptions()
+	flag.StringVar(&opts.addr, "addr", "localhost:8888", "server address for send")
+	flag.Float64Var(&opts.speed, "speed", defaults.Speed, "replay speed factor, 0 sends frames back to back")
+	flag.BoolVar(&opts.rewrite, "rewrite", false, "point submits at the live job and recompute their result with the recorded client nonce")
+	flag.DurationVar(&opts.wait, "wait", defaults.Wait, "wait for a live job before a rewritten submit, and for answers after the last frame")
+	flag.BoolVar(&opts.asJSON, "json", false, "print JSON")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if err := run(opts); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
+
+func run(opts options) error {
+	if flag.NArg() < 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	rec, err := record.ReadFile(flag.Arg(1))
+	if err != nil {
+		return err
+	}
+	recorded := record.Verify(rec)
+
+	var result interface{}
+	var rows [][]interface{}
+	switch flag.Arg(0) {
+	case "verify":
+		result, rows = recorded, [][]interface{}{{"TIME", "ID", "JOB", "CLIENT_NONCE", "RESULT", "ANSWER", ""}}
+		for _, c := range recorded {
+			rows = append(rows, []interface{}{c.Time.Format(time.RFC3339Nano), id(c.RequestID), c.JobID, c.ClientNonce, verdict(c), answer(c), flagged(c.Suspect())})
+		}
+	case "send":
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		conn, err := net.DialTimeout("tcp", opts.addr, 10*time.Second)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		live, err := record.Replay(ctx, conn, rec, record.ReplayOptions{Speed: opts.speed, Rewrite: opts.rewrite, Wait: opts.wait})
+		if err != nil {
+			return err
+		}
+		replayed := record.Verify(live)
+		result = map[string]interface{}{"recorded": recorded, "live": replayed}
+		// submits are replayed in order, the nth live check answers the nth recorded one
+		rows = [][]interface{}{{"#", "ID", "JOB", "LIVE_JOB", "RECORDED", "LIVE", ""}}
+		for i := 0; i < len(recorded) || i < len(replayed); i++ {
+			var r, l record.Check
+			if i < len(recorded) {
+				r = recorded[i]
+			}
+			if i < len(replayed) {
+				l = replayed[i]
+			}
+			rows = append(rows, []interface{}{i + 1, id(r.RequestID), r.JobID, l.JobID, answer(r), answer(l), flagged(answer(r) != answer(l))})
+		}
+	default:
+		return fmt.Errorf("unknown command: %s", flag.Arg(0))
+	}
+
+	if opts.asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(result)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, row := range rows {
+		for i, col := range row {
+			if i > 0 {
+				fmt.Fprint(tw, "\t")
+			}
+			fmt.Fprint(tw, col)
+		}
+		fmt.Fprintln(tw)
+	}
+	return tw.Flush()
+}
+
+func id(v *int) interface{} {
+	if v == nil {
+		return "-"
+	}
+	return *v
+}
+
+// verdict of the recomputed result
+func verdict(c record.Check) string {
+	switch {
+	case c.ParamsError != "":
+		return c.ParamsError
+	case c.Expected == "":
+		return "job not recorded"
+	case c.Valid():
+		return "valid"
+	default:
+		return "invalid, expected " + c.Expected
+	}
+}
+
+func answer(c record.Check) string {
+	switch {
+	case !c.Answered:
+		return "-"
+	case c.Accepted:
+		return "accepted"
+	default:
+		return c.Error
+	}
+}
+
+func flagged(b bool) string {
+	if b {
+		return "<<"
+	}
+	return ""
+}
@@ -1,28 +1,177 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"luxor.tech/tcp_msg_processing_test/internal/accounting"
+	"luxor.tech/tcp_msg_processing_test/internal/admin"
+	"luxor.tech/tcp_msg_processing_test/internal/jobsource"
+	"luxor.tech/tcp_msg_processing_test/internal/rollup"
 	"luxor.tech/tcp_msg_processing_test/internal/server"
+	"luxor.tech/tcp_msg_processing_test/internal/stats"
+	"luxor.tech/tcp_msg_processing_test/pkg/clock"
 	"luxor.tech/tcp_msg_processing_test/pkg/logger"
+	"luxor.tech/tcp_msg_processing_test/pkg/metrics"
 	rds_db "luxor.tech/tcp_msg_processing_test/rds-db"
 )
 
 // main 启动程序入口
 func main() {
+	addr := flag.String("addr", ":8888", "listen address")
+	wsAddr := flag.String("ws-addr", "", "websocket listen address, serves "+server.WebSocketPath+" when set")
+	metricsAddr := flag.String("metrics-addr", "", "prometheus "+metrics.Path+" listen address, disabled when empty")
+	adminAddr := flag.String("admin-addr", "", "admin http api listen address, disabled when empty")
+	adminToken := flag.String("admin-token", os.Getenv("ADMIN_TOKEN"), "admin api bearer token, defaults to $ADMIN_TOKEN")
+	dbConfigFile := flag.String("db-config", "config/db_config.json", "database config file, $DATABASE_URL overrides the dsn")
+	spoolFile := flag.String("spool-file", "", "write-ahead file of shares the database rejected, e.g. data/submissions.spool, disabled when empty")
+	spoolMaxBytes := flag.Int64("spool-max-bytes", 64<<20, "spool size limit in bytes")
+	recordDir := flag.String("record-dir", "data/recordings", "directory of traffic recordings enabled per username through the admin api, empty disables")
+	jobSource := flag.String("job-source", "random", "origin of jobs: random, file:<path> (a block template JSON or server nonce per line, the last one repeats), template:<path> (a watched block template JSON file), node (local stand-in for an upstream node)")
+	blockInterval := flag.Duration("block-interval", 10*time.Minute, "period of new blocks of the node job source")
+	rollupInterval := flag.Duration("rollup-interval", rollup.DefaultConfig().Interval, "period of the statistics rollup job, 0 disables")
+	minuteRetention := flag.Duration("minute-retention", rollup.DefaultConfig().MinuteRetention, "minute statistics kept once rolled up, 0 keeps all")
+	hourlyRetention := flag.Duration("hourly-retention", rollup.DefaultConfig().HourlyRetention, "hourly statistics kept once rolled up, 0 keeps all")
+	replayRetention := flag.Duration("replay-retention", rollup.DefaultConfig().ReplayRetention, "ids of replayed spool records kept, 0 keeps all")
+	rejectionRetention := flag.Duration("rejection-retention", rollup.DefaultConfig().RejectionRetention, "rejected share counters kept, 0 keeps all")
+	tlsCert := flag.String("tls-cert", "", "tls certificate file, enables tls")
+	tlsKey := flag.String("tls-key", "", "tls private key file")
+	tlsClientCA := flag.String("tls-client-ca", "", "CA bundle verifying client certificates")
+	tlsClientAuth := flag.String("tls-client-auth", "none", "client certificate mode: none|request|require|verify|require-verify")
+	flag.Parse()
+
 	// Initialize logger
 	err := logger.InitLogger("config/log_config.json")
 	if err != nil {
 		panic("Failed to initialize logger: " + err.Error())
 	}
+	defer logger.Close()
+	go logger.HandleLevelSignals()
 
 	// Start db link
-	rds_db.GetDb()
+	dbConfig, err := rds_db.LoadConfig(*dbConfigFile)
+	if err != nil {
+		panic("Failed to load db config: " + err.Error())
+	}
+	if err := rds_db.Init(dbConfig); err != nil {
+		panic(err)
+	}
+	db, err := rds_db.GetDb()
+	if err != nil {
+		panic(err)
+	}
+
+	if flag.Arg(0) == "migrate" {
+		if err := runMigrate(db, flag.Args()[1:]); err != nil {
+			logger.Error("Migration failed: %v", err)
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	rollupConfig := rollup.DefaultConfig()
+	rollupConfig.Interval = *rollupInterval
+	rollupConfig.MinuteRetention = *minuteRetention
+	rollupConfig.HourlyRetention = *hourlyRetention
+	rollupConfig.ReplayRetention = *replayRetention
+	rollupConfig.RejectionRetention = *rejectionRetention
+	go rollup.NewRoller(db, rollupConfig).Start(context.Background())
 
-	newServer := server.NewServer()
+	cfg := server.DefaultConfig()
+	cfg.SpoolFile = *spoolFile
+	cfg.SpoolMaxBytes = *spoolMaxBytes
+	cfg.RecordDir = *recordDir
+	if *tlsCert != "" {
+		clientAuth, err := server.ParseClientAuth(*tlsClientAuth)
+		if err != nil {
+			panic(err)
+		}
+		cfg.TLS = &server.TLSConfig{
+			CertFile:     *tlsCert,
+			KeyFile:      *tlsKey,
+			ClientCAFile: *tlsClientCA,
+			ClientAuth:   clientAuth,
+		}
+	}
+
+	newServer := server.NewServerWithConfig(cfg)
 	if newServer == nil {
 		panic("create server nil")
 	}
-	err = newServer.Start(":8888")
+	template, err := setJobSource(newServer, *jobSource, *blockInterval)
 	if err != nil {
 		panic(err)
 	}
+	if *metricsAddr != "" {
+		go func() {
+			if err := metrics.Serve(*metricsAddr); err != nil {
+				panic(err)
+			}
+		}()
+	}
+	if *adminAddr != "" {
+		go func() {
+			adminAPI := admin.NewAdmin(*adminAddr, *adminToken, newServer)
+			adminAPI.EnableStats(stats.NewService(db))
+			adminAPI.EnableAccounting(accounting.NewLedger(db))
+			if template != nil {
+				adminAPI.EnableTemplates(template)
+			}
+			if err := adminAPI.Start(); err != nil {
+				panic(err)
+			}
+		}()
+	}
+	if *wsAddr != "" {
+		go func() {
+			if err := newServer.StartWebSocket(*wsAddr); err != nil {
+				panic(err)
+			}
+		}()
+	}
+	err = newServer.Start(*addr)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// setJobSource replace the random nonces of srv as described by spec, returns the block template jobs derive from
+// when there is one
+func setJobSource(srv *server.Server, spec string, blockInterval time.Duration) (*jobsource.Template, error) {
+	var template *jobsource.Template
+	kind, path, _ := strings.Cut(spec, ":")
+	switch kind {
+	case "random":
+		return nil, nil
+	case "file":
+		queue, err := jobsource.NewFileQueue(path)
+		if err != nil {
+			return nil, err
+		}
+		srv.SetJobSource(queue)
+	case "template":
+		current, err := jobsource.LoadTemplate(path)
+		if err != nil {
+			return nil, err
+		}
+		if template, err = jobsource.NewTemplate(current); err != nil {
+			return nil, err
+		}
+		go jobsource.WatchTemplate(path, template, clock.Real, time.Second, nil)
+		srv.SetJobSource(template)
+	case "node":
+		node := jobsource.NewNode(clock.Real)
+		go node.Run(blockInterval, nil)
+		srv.SetJobSource(node)
+		template = node.Template
+	default:
+		return nil, fmt.Errorf("unknown job source: %s", spec)
+	}
+	logger.Info("Jobs come from source:%v", spec)
+	return template, nil
 }
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"luxor.tech/tcp_msg_processing_test/internal/stats"
+	"luxor.tech/tcp_msg_processing_test/pkg/logger"
+	rds_db "luxor.tech/tcp_msg_processing_test/rds-db"
+)
+
+const usage = `usage: stats [flags] user <username> | top | totals | rejections [username]
+  user <username>        submissions of a user per -granularity
+  top                    top -n users
+  totals                 distinct users and submissions
+  rejections [username]  rejected shares by reason and acceptance ratio per user
+flags:`
+
+// main submission statistics queries
+func main() {
+	dbConfigFile := flag.String("db-config", "config/db_config.json", "database config file, $DATABASE_URL overrides the dsn")
+	from := flag.String("from", "", "window start, RFC3339, defaults to 24h before -to")
+	to := flag.String("to", "", "window end (exclusive), RFC3339, defaults to now")
+	granularity := flag.String("granularity", "hour", "minute|hour|day")
+	n := flag.Int("n", 10, "number of top users")
+	asJSON := flag.Bool("json", false, "print JSON")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if err := run(*dbConfigFile, *from, *to, *granularity, *n, *asJSON); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
+
+func run(dbConfigFile, fromStr, toStr, granularityStr string, n int, asJSON bool) error {
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	from, to, err := stats.ParseWindow(fromStr, toStr, time.Now())
+	if err != nil {
+		return err
+	}
+
+	// keep stdout for results
+	l, _ := logger.NewLogger(os.Stderr, logger.Config{LogLevel: "warn"})
+	logger.SetDefault(l)
+	dbConfig, err := rds_db.LoadConfig(dbConfigFile)
+	if err != nil {
+		return err
+	}
+	dbConfig.ConnectRetries, dbConfig.HealthCheckInterval = 1, 0
+	if err := rds_db.Init(dbConfig); err != nil {
+		return err
+	}
+	db, err := rds_db.GetDb()
+	if err != nil {
+		return err
+	}
+	svc := stats.NewService(db)
+	ctx := context.Background()
+
+	var result interface{}
+	var rows [][]interface{}
+	switch flag.Arg(0) {
+	case "user":
+		if flag.NArg() < 2 {
+			return fmt.Errorf("username required")
+		}
+		granularity, err := stats.ParseGranularity(granularityStr)
+		if err != nil {
+			return err
+		}
+		points, err := svc.UserSeries(ctx, flag.Arg(1), from, to, granularity)
+		if err != nil {
+			return err
+		}
+		result, rows = points, [][]interface{}{{"TIME", "SUBMISSIONS"}}
+		for _, p := range points {
+			rows = append(rows, []interface{}{p.Time.Format(time.RFC3339), p.Count})
+		}
+	case "top":
+		users, err := svc.TopUsers(ctx, from, to, n)
+		if err != nil {
+			return err
+		}
+		result, rows = users, [][]interface{}{{"USERNAME", "SUBMISSIONS"}}
+		for _, u := range users {
+			rows = append(rows, []interface{}{u.Username, u.Count})
+		}
+	case "totals":
+		totals, err := svc.Totals(ctx, from, to)
+		if err != nil {
+			return err
+		}
+		result = totals
+		rows = [][]interface{}{{"FROM", "TO", "USERS", "SUBMISSIONS"},
+			{totals.From.Format(time.RFC3339), totals.To.Format(time.RFC3339), totals.Users, totals.Submissions}}
+	case "rejections":
+		users, err := svc.Rejections(ctx, flag.Arg(1), from, to)
+		if err != nil {
+			return err
+		}
+		result, rows = users, [][]interface{}{{"USERNAME", "ACCEPTED", "REJECTED", "RATIO", "REASONS"}}
+		for _, u := range users {
+			rows = append(rows, []interface{}{u.Username, u.Accepted, u.Rejected, fmt.Sprintf("%.4f", u.AcceptanceRatio), reasons(u.Reasons)})
+		}
+	default:
+		return fmt.Errorf("unknown command: %s", flag.Arg(0))
+	}
+
+	if asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(result)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, row := range rows {
+		for i, col := range row {
+			if i > 0 {
+				fmt.Fprint(tw, "\t")
+			}
+			fmt.Fprint(tw, col)
+		}
+		fmt.Fprintln(tw)
+	}
+	return tw.Flush()
+}
+
+// reasons format rejection counts as "reason=count" sorted by reason
+func reasons(counts map[string]int64) string {
+	parts := make([]string, 0, len(counts))
+	for reason, count := range counts {
+		parts = append(parts, fmt.Sprintf("%s=%d", reason, count))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,316 @@
+package accounting
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"luxor.tech/tcp_msg_processing_test/pkg/logger"
+	rds_db "luxor.tech/tcp_msg_processing_test/rds-db"
+)
+
+const (
+	PPLNS = "pplns"
+	PPS   = "pps"
+
+	// ledgerLockID pg advisory lock key, serializes payout rounds across servers
+	ledgerLockID = 7_340_114
+)
+
+var (
+	ErrRoundExists  = errors.New("payout round already credited")
+	ErrPeriodCredit = errors.New("period overlaps a credited pps round")
+	ErrNoShares     = errors.New("no shares to credit")
+)
+
+type Credit struct {
+	Username string `json:"username"`
+	Shares   int64  `json:"shares"`
+	Amount   int64  `json:"amount"`
+}
+
+// Round one payout calculation and the credits it added to the ledger
+type Round struct {
+	ID        int64     `json:"id"`
+	Ref       string    `json:"ref"`
+	Scheme    string    `json:"scheme"`
+	Reward    int64     `json:"reward"`
+	Shares    int64     `json:"shares"`
+	From      time.Time `json:"from"`
+	To        time.Time `json:"to"`
+	CreatedAt time.Time `json:"created_at"`
+	Credits   []Credit  `json:"credits"`
+}
+
+type Balance struct {
+	Username string `json:"username"`
+	Shares   int64  `json:"shares"`
+	Amount   int64  `json:"amount"`
+}
+
+type Entry struct {
+	ID        int64     `json:"id"`
+	RoundID   int64     `json:"round_id"`
+	Ref       string    `json:"ref"`
+	Scheme    string    `json:"scheme"`
+	Username  string    `json:"username"`
+	Shares    int64     `json:"shares"`
+	Amount    int64     `json:"amount"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Ledger credit users for accepted shares and report their balances. Shares are read from the
+// submission_counts view, so windows older than minute retention are only as precise as the rollups.
+type Ledger struct {
+	db *sql.DB
+}
+
+func NewLedger(db *sql.DB) *Ledger {
+	return &Ledger{db: db}
+}
+
+// CreditBlock split reward of the block ref among the last n shares accepted before at (PPLNS)
+func (l *Ledger) CreditBlock(ctx context.Context, ref string, reward, n int64, at time.Time) (Round, error) {
+	if ref == "" || reward <= 0 || n <= 0 {
+		return Round{}, fmt.Errorf("ref, positive reward and n required")
+	}
+	at = at.UTC()
+	return l.credit(ctx, Round{Ref: PPLNS + ":" + ref, Scheme: PPLNS, To: at}, func(tx *sql.Tx, round *Round) (map[string]int64, map[string]int64, error) {
+		buckets, err := lastShares(ctx, tx, at, n)
+		if err != nil || len(buckets) == 0 {
+			return nil, nil, err
+		}
+		round.From = buckets[len(buckets)-1].Time
+		shares := PPLNSShares(buckets, n)
+		return shares, Split(reward, shares), nil
+	})
+}
+
+// CreditPeriod pay rate per share accepted in [from, to) (PPS), periods are credited at most once
+func (l *Ledger) CreditPeriod(ctx context.Context, from, to time.Time, rate int64) (Round, error) {
+	if rate <= 0 || !from.Before(to) {
+		return Round{}, fmt.Errorf("positive rate and from before to required")
+	}
+	from, to = from.UTC(), to.UTC()
+	ref := fmt.Sprintf("%s:%s/%s", PPS, from.Format(time.RFC3339), to.Format(time.RFC3339))
+	return l.credit(ctx, Round{Ref: ref, Scheme: PPS, From: from, To: to}, func(tx *sql.Tx, _ *Round) (map[string]int64, map[string]int64, error) {
+		var overlap bool
+		err := tx.QueryRowContext(ctx, `
+			SELECT EXISTS (SELECT 1 FROM payout_rounds WHERE scheme = $1 AND window_from < $3 AND window_to > $2)`,
+			PPS, from, to).Scan(&overlap)
+		if err != nil {
+			return nil, nil, err
+		}
+		if overlap {
+			return nil, nil, ErrPeriodCredit
+		}
+		shares, err := periodShares(ctx, tx, from, to)
+		if err != nil {
+			return nil, nil, err
+		}
+		return shares, PPSCredits(shares, rate), nil
+	})
+}
+
+// credit run calc and record the round with its credits in one transaction
+func (l *Ledger) credit(ctx context.Context, round Round, calc func(tx *sql.Tx, round *Round) (map[string]int64, map[string]int64, error)) (Round, error) {
+	tx, err := l.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Round{}, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, ledgerLockID); err != nil {
+		return Round{}, err
+	}
+	var exist bool
+	if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM payout_rounds WHERE ref = $1)`, round.Ref).Scan(&exist); err != nil {
+		return Round{}, err
+	}
+	if exist {
+		return Round{}, ErrRoundExists
+	}
+
+	shares, credits, err := calc(tx, &round)
+	if err != nil {
+		return Round{}, err
+	}
+	round.Credits = make([]Credit, 0, len(credits))
+	var reward int64
+	for username, amount := range credits {
+		round.Credits = append(round.Credits, Credit{Username: username, Shares: shares[username], Amount: amount})
+		round.Shares += shares[username]
+		reward += amount
+	}
+	if len(round.Credits) == 0 {
+		return Round{}, ErrNoShares
+	}
+	sort.Slice(round.Credits, func(i, j int) bool {
+		return round.Credits[i].Username < round.Credits[j].Username
+	})
+	round.Reward = reward
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO payout_rounds (ref, scheme, reward, shares, window_from, window_to)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at`,
+		round.Ref, round.Scheme, round.Reward, round.Shares, round.From, round.To).Scan(&round.ID, &round.CreatedAt)
+	if err != nil {
+		return Round{}, err
+	}
+	for _, c := range round.Credits {
+		_, err := tx.ExecContext(ctx, `INSERT INTO ledger (round_id, username, shares, amount) VALUES ($1, $2, $3, $4)`,
+			round.ID, c.Username, c.Shares, c.Amount)
+		if err != nil {
+			return Round{}, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return Round{}, err
+	}
+	round.CreatedAt = round.CreatedAt.UTC()
+	logger.Infow("Payout round credited", "ref", round.Ref, "scheme", round.Scheme, "reward", round.Reward,
+		"shares", round.Shares, "users", len(round.Credits))
+	return round, nil
+}
+
+// lastShares buckets before at, newest first, until they hold at least n shares
+func lastShares(ctx context.Context, tx *sql.Tx, at time.Time, n int64) ([]Bucket, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT username, timestamp, submission_count
+		FROM (
+			SELECT username, timestamp, submission_count,
+				SUM(submission_count) OVER (ORDER BY timestamp DESC, username) AS counted
+			FROM submission_counts
+			WHERE timestamp < $1
+		) AS recent
+		WHERE counted - submission_count < $2
+		ORDER BY timestamp DESC, username`, at, n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	buckets := make([]Bucket, 0)
+	for rows.Next() {
+		var b Bucket
+		if err := rows.Scan(&b.Username, &b.Time, &b.Shares); err != nil {
+			return nil, err
+		}
+		b.Time = b.Time.UTC()
+		buckets = append(buckets, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// rows of the boundary time past n are cut by the window, PPLNSShares needs all of them
+	if len(buckets) > 0 {
+		oldest := buckets[len(buckets)-1]
+		rows, err := tx.QueryContext(ctx, `
+			SELECT username, submission_count FROM submission_counts WHERE timestamp = $1 AND username > $2
+			ORDER BY username`, oldest.Time, oldest.Username)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			b := Bucket{Time: oldest.Time}
+			if err := rows.Scan(&b.Username, &b.Shares); err != nil {
+				return nil, err
+			}
+			buckets = append(buckets, b)
+		}
+		return buckets, rows.Err()
+	}
+	return buckets, nil
+}
+
+func periodShares(ctx context.Context, tx *sql.Tx, from, to time.Time) (map[string]int64, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT username, SUM(submission_count)
+		FROM submission_counts
+		WHERE timestamp >= $1 AND timestamp < $2
+		GROUP BY username`, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	shares := make(map[string]int64)
+	for rows.Next() {
+		var username string
+		var count int64
+		if err := rows.Scan(&username, &count); err != nil {
+			return nil, err
+		}
+		shares[username] = count
+	}
+	return shares, rows.Err()
+}
+
+// Balances credited amount of every user, largest first
+func (l *Ledger) Balances(ctx context.Context) ([]Balance, error) {
+	ctx, cancel := rds_db.QueryContext(ctx)
+	defer cancel()
+	rows, err := l.db.QueryContext(ctx, `
+		SELECT username, SUM(shares), SUM(amount) AS total
+		FROM ledger
+		GROUP BY username
+		ORDER BY total DESC, username`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	balances := make([]Balance, 0)
+	for rows.Next() {
+		var b Balance
+		if err := rows.Scan(&b.Username, &b.Shares, &b.Amount); err != nil {
+			return nil, err
+		}
+		balances = append(balances, b)
+	}
+	return balances, rows.Err()
+}
+
+// Balance credited amount of username, zero when never credited
+func (l *Ledger) Balance(ctx context.Context, username string) (Balance, error) {
+	ctx, cancel := rds_db.QueryContext(ctx)
+	defer cancel()
+	b := Balance{Username: username}
+	err := l.db.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(shares), 0), COALESCE(SUM(amount), 0) FROM ledger WHERE username = $1`,
+		username).Scan(&b.Shares, &b.Amount)
+	return b, err
+}
+
+// Entries the latest limit ledger entries, of username only when set
+func (l *Ledger) Entries(ctx context.Context, username string, limit int) ([]Entry, error) {
+	ctx, cancel := rds_db.QueryContext(ctx)
+	defer cancel()
+	rows, err := l.db.QueryContext(ctx, `
+		SELECT l.id, l.round_id, r.ref, r.scheme, l.username, l.shares, l.amount, l.created_at
+		FROM ledger l JOIN payout_rounds r ON r.id = l.round_id
+		WHERE $1 = '' OR l.username = $1
+		ORDER BY l.id DESC
+		LIMIT $2`, username, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make([]Entry, 0, limit)
+	for rows.Next() {
+		var e Entry
+		if err := rows.Scan(&e.ID, &e.RoundID, &e.Ref, &e.Scheme, &e.Username, &e.Shares, &e.Amount, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		e.CreatedAt = e.CreatedAt.UTC()
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
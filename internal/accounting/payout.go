@@ -0,0 +1,94 @@
+package accounting
+
+import (
+	"math/bits"
+	"sort"
+	"time"
+)
+
+// Bucket accepted shares of a user in one statistics bucket
+type Bucket struct {
+	Username string
+	Time     time.Time
+	Shares   int64
+}
+
+// Split divide reward among users proportionally to their shares. Amounts are rounded down and the
+// remainder goes one unit at a time to the largest fractions, so credits always sum to reward.
+func Split(reward int64, shares map[string]int64) map[string]int64 {
+	credits := make(map[string]int64, len(shares))
+	var total uint64
+	for _, n := range shares {
+		if n > 0 {
+			total += uint64(n)
+		}
+	}
+	if total == 0 || reward <= 0 {
+		return credits
+	}
+
+	type fraction struct {
+		username  string
+		remainder uint64
+	}
+	fractions := make([]fraction, 0, len(shares))
+	left := reward
+	for username, n := range shares {
+		if n <= 0 {
+			continue
+		}
+		// reward*n/total without overflow, n <= total so the quotient fits
+		hi, lo := bits.Mul64(uint64(reward), uint64(n))
+		quo, rem := bits.Div64(hi, lo, total)
+		credits[username] = int64(quo)
+		left -= int64(quo)
+		fractions = append(fractions, fraction{username: username, remainder: rem})
+	}
+	sort.Slice(fractions, func(i, j int) bool {
+		if fractions[i].remainder != fractions[j].remainder {
+			return fractions[i].remainder > fractions[j].remainder
+		}
+		return fractions[i].username < fractions[j].username
+	})
+	for i := 0; left > 0; i, left = (i+1)%len(fractions), left-1 {
+		credits[fractions[i].username]++
+	}
+	return credits
+}
+
+// PPLNSShares shares per user among the last n shares of buckets, which are ordered newest first.
+// Shares of the oldest bucket reached are scaled down so exactly n are counted, or all when fewer.
+func PPLNSShares(buckets []Bucket, n int64) map[string]int64 {
+	shares := make(map[string]int64)
+	left := n
+	for i := 0; i < len(buckets) && left > 0; {
+		// buckets of the same time are equally old, take them together
+		at := buckets[i].Time
+		group := make(map[string]int64)
+		var total int64
+		for ; i < len(buckets) && buckets[i].Time.Equal(at); i++ {
+			group[buckets[i].Username] += buckets[i].Shares
+			total += buckets[i].Shares
+		}
+		if total > left {
+			group = Split(left, group)
+			total = left
+		}
+		for username, count := range group {
+			shares[username] += count
+		}
+		left -= total
+	}
+	return shares
+}
+
+// PPSCredits pay every share a fixed rate
+func PPSCredits(shares map[string]int64, rate int64) map[string]int64 {
+	credits := make(map[string]int64, len(shares))
+	for username, n := range shares {
+		if n > 0 {
+			credits[username] = n * rate
+		}
+	}
+	return credits
+}
@@ -0,0 +1,96 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"luxor.tech/tcp_msg_processing_test/internal/accounting"
+	"luxor.tech/tcp_msg_processing_test/pkg/logger"
+)
+
+const maxLedgerEntries = 1000
+
+// EnableAccounting expose payout rounds and balances
+func (a *Admin) EnableAccounting(ledger *accounting.Ledger) {
+	// credit a found block with PPLNS
+	a.mux.HandleFunc("POST /accounting/blocks", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Ref    string    `json:"ref"`
+			Reward int64     `json:"reward"`
+			N      int64     `json:"n"`
+			Time   time.Time `json:"time"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Ref == "" || req.Reward <= 0 || req.N <= 0 {
+			WriteError(w, http.StatusBadRequest, "ref, positive reward and n required")
+			return
+		}
+		if req.Time.IsZero() {
+			req.Time = time.Now()
+		}
+		round, err := ledger.CreditBlock(r.Context(), req.Ref, req.Reward, req.N, req.Time)
+		writeRound(w, round, err)
+	})
+	// credit a period with PPS
+	a.mux.HandleFunc("POST /accounting/periods", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			From time.Time `json:"from"`
+			To   time.Time `json:"to"`
+			Rate int64     `json:"rate"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Rate <= 0 || !req.From.Before(req.To) {
+			WriteError(w, http.StatusBadRequest, "positive rate and from before to required")
+			return
+		}
+		round, err := ledger.CreditPeriod(r.Context(), req.From, req.To, req.Rate)
+		writeRound(w, round, err)
+	})
+	a.mux.HandleFunc("GET /accounting/balances", func(w http.ResponseWriter, r *http.Request) {
+		balances, err := ledger.Balances(r.Context())
+		if err != nil {
+			queryFailed(w, err)
+			return
+		}
+		WriteJSON(w, http.StatusOK, balances)
+	})
+	a.mux.HandleFunc("GET /accounting/balances/{username}", func(w http.ResponseWriter, r *http.Request) {
+		balance, err := ledger.Balance(r.Context(), r.PathValue("username"))
+		if err != nil {
+			queryFailed(w, err)
+			return
+		}
+		WriteJSON(w, http.StatusOK, balance)
+	})
+	a.mux.HandleFunc("GET /accounting/ledger", func(w http.ResponseWriter, r *http.Request) {
+		limit := 100
+		if v := r.URL.Query().Get("limit"); v != "" {
+			var err error
+			if limit, err = strconv.Atoi(v); err != nil || limit < 1 || limit > maxLedgerEntries {
+				WriteError(w, http.StatusBadRequest, "limit must be within 1-1000")
+				return
+			}
+		}
+		entries, err := ledger.Entries(r.Context(), r.URL.Query().Get("username"), limit)
+		if err != nil {
+			queryFailed(w, err)
+			return
+		}
+		WriteJSON(w, http.StatusOK, entries)
+	})
+}
+
+func writeRound(w http.ResponseWriter, round accounting.Round, err error) {
+	switch {
+	case err == nil:
+		WriteJSON(w, http.StatusCreated, round)
+	case errors.Is(err, accounting.ErrRoundExists), errors.Is(err, accounting.ErrPeriodCredit):
+		WriteError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, accounting.ErrNoShares):
+		WriteError(w, http.StatusUnprocessableEntity, err.Error())
+	default:
+		logger.Error("Payout round failed: %v", err)
+		WriteError(w, http.StatusServiceUnavailable, "payout round failed")
+	}
+}
@@ -0,0 +1,295 @@
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"luxor.tech/tcp_msg_processing_test/internal/server"
+	"luxor.tech/tcp_msg_processing_test/pkg/logger"
+)
+
+const (
+	readHeaderTimeout = 5 * time.Second
+	readTimeout       = 10 * time.Second
+	writeTimeout      = 30 * time.Second
+	idleTimeout       = time.Minute
+)
+
+// Admin operator HTTP API over a running server, every request needs
+// "Authorization: Bearer <token>"
+type Admin struct {
+	addr  string
+	token string
+	srv   *server.Server
+	mux   *http.ServeMux
+}
+
+func NewAdmin(addr, token string, srv *server.Server) *Admin {
+	a := &Admin{
+		addr:  addr,
+		token: token,
+		srv:   srv,
+		mux:   http.NewServeMux(),
+	}
+	a.mux.HandleFunc("GET /sessions", a.listSessions)
+	a.mux.HandleFunc("DELETE /sessions/{id}", a.kickSession)
+	a.mux.HandleFunc("GET /bans", a.listBans)
+	a.mux.HandleFunc("POST /bans", a.ban)
+	a.mux.HandleFunc("DELETE /bans", a.unban)
+	a.mux.HandleFunc("POST /jobs", a.distributeJob)
+	a.mux.HandleFunc("GET /config", a.viewConfig)
+	a.mux.HandleFunc("GET /log", a.viewLog)
+	a.mux.HandleFunc("PUT /log/level", a.setLogLevel)
+	a.mux.HandleFunc("POST /log/debug", a.enableDebug)
+	a.mux.HandleFunc("DELETE /log/debug", a.disableDebug)
+	a.mux.HandleFunc("GET /recordings", a.listRecordings)
+	a.mux.HandleFunc("POST /recordings", a.startRecording)
+	a.mux.HandleFunc("DELETE /recordings", a.stopRecording)
+	return a
+}
+
+// Handle register an extra authenticated endpoint
+func (a *Admin) Handle(pattern string, handler http.HandlerFunc) {
+	a.mux.HandleFunc(pattern, handler)
+}
+
+// Start listen on the admin address and serve until the server is closed
+func (a *Admin) Start() error {
+	if a.token == "" {
+		return fmt.Errorf("admin token required")
+	}
+	listener, err := net.Listen("tcp", a.addr)
+	if err != nil {
+		return err
+	}
+	return a.Serve(listener)
+}
+
+// Serve the api on listener until the server is closed, requests are bounded by the http timeouts
+func (a *Admin) Serve(listener net.Listener) error {
+	if a.token == "" {
+		listener.Close()
+		return fmt.Errorf("admin token required")
+	}
+	httpServer := &http.Server{
+		Handler:           a,
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       readTimeout,
+		WriteTimeout:      writeTimeout,
+		IdleTimeout:       idleTimeout,
+	}
+	go func() {
+		<-a.srv.Done()
+		httpServer.Close()
+	}()
+	logger.Info("Admin api is listening on port:%v", listener.Addr())
+	if err := httpServer.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (a *Admin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found || a.token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) != 1 {
+		WriteError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	a.mux.ServeHTTP(w, r)
+}
+
+func (a *Admin) listSessions(w http.ResponseWriter, _ *http.Request) {
+	WriteJSON(w, http.StatusOK, a.srv.Sessions())
+}
+
+func (a *Admin) kickSession(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "invalid session id")
+		return
+	}
+	if !a.srv.Kick(id) {
+		WriteError(w, http.StatusNotFound, "session not found")
+		return
+	}
+	WriteJSON(w, http.StatusOK, map[string]interface{}{"kicked": id})
+}
+
+type banRequest struct {
+	Username string `json:"username"`
+	IP       string `json:"ip"`
+}
+
+func (a *Admin) listBans(w http.ResponseWriter, _ *http.Request) {
+	usernames, ips := a.srv.Bans()
+	WriteJSON(w, http.StatusOK, map[string]interface{}{"usernames": usernames, "ips": ips})
+}
+
+func (a *Admin) ban(w http.ResponseWriter, r *http.Request) {
+	var req banRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || (req.Username == "" && req.IP == "") {
+		WriteError(w, http.StatusBadRequest, "username or ip required")
+		return
+	}
+	kicked := 0
+	if req.Username != "" {
+		kicked += a.srv.BanUsername(req.Username)
+	}
+	if req.IP != "" {
+		kicked += a.srv.BanIP(req.IP)
+	}
+	logger.Info("Admin banned username:%q ip:%q, kicked %d sessions", req.Username, req.IP, kicked)
+	WriteJSON(w, http.StatusOK, map[string]interface{}{"kicked": kicked})
+}
+
+func (a *Admin) unban(w http.ResponseWriter, r *http.Request) {
+	username, ip := r.URL.Query().Get("username"), r.URL.Query().Get("ip")
+	if username == "" && ip == "" {
+		WriteError(w, http.StatusBadRequest, "username or ip required")
+		return
+	}
+	if username != "" {
+		a.srv.UnbanUsername(username)
+	}
+	if ip != "" {
+		a.srv.UnbanIP(ip)
+	}
+	WriteJSON(w, http.StatusOK, map[string]interface{}{"unbanned": true})
+}
+
+// distributeJob resend the current job to one username when given, or push a new job to every authorized session
+func (a *Admin) distributeJob(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Username string `json:"username"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			WriteError(w, http.StatusBadRequest, "invalid body")
+			return
+		}
+	}
+	var sent int
+	if req.Username != "" {
+		sent = a.srv.DistributeTo(req.Username)
+	} else {
+		sent = a.srv.BroadcastJob()
+	}
+	WriteJSON(w, http.StatusOK, map[string]interface{}{"sent": sent})
+}
+
+func (a *Admin) viewConfig(w http.ResponseWriter, _ *http.Request) {
+	WriteJSON(w, http.StatusOK, a.srv.Config())
+}
+
+func (a *Admin) viewLog(w http.ResponseWriter, _ *http.Request) {
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"level":         strings.ToLower(logger.GetLevel().String()),
+		"debug_targets": logger.DebugTargets(),
+	})
+}
+
+// setLogLevel override the log level, empty level restores the configured one
+func (a *Admin) setLogLevel(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Level string `json:"level"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "invalid body")
+		return
+	}
+	if req.Level == "" {
+		logger.ResetLevel()
+	} else {
+		level, err := logger.ParseLevel(req.Level)
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		logger.SetLevel(level)
+	}
+	a.viewLog(w, r)
+}
+
+type debugTarget struct {
+	Username  string `json:"username"`
+	SessionID uint64 `json:"session_id"`
+}
+
+// enableDebug log debug records of one username and/or session whatever the level
+func (a *Admin) enableDebug(w http.ResponseWriter, r *http.Request) {
+	var req debugTarget
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || (req.Username == "" && req.SessionID == 0) {
+		WriteError(w, http.StatusBadRequest, "username or session_id required")
+		return
+	}
+	if req.Username != "" {
+		logger.EnableDebugFor("username", req.Username)
+	}
+	if req.SessionID != 0 {
+		logger.EnableDebugFor("session_id", strconv.FormatUint(req.SessionID, 10))
+	}
+	a.viewLog(w, r)
+}
+
+func (a *Admin) disableDebug(w http.ResponseWriter, r *http.Request) {
+	username, sessionID := r.URL.Query().Get("username"), r.URL.Query().Get("session_id")
+	if username == "" && sessionID == "" {
+		WriteError(w, http.StatusBadRequest, "username or session_id required")
+		return
+	}
+	if username != "" {
+		logger.DisableDebugFor("username", username)
+	}
+	if sessionID != "" {
+		logger.DisableDebugFor("session_id", sessionID)
+	}
+	a.viewLog(w, r)
+}
+
+func (a *Admin) listRecordings(w http.ResponseWriter, _ *http.Request) {
+	WriteJSON(w, http.StatusOK, map[string]interface{}{"record_dir": a.srv.Config().RecordDir, "usernames": a.srv.Recordings()})
+}
+
+// startRecording record the traffic of every connection of a username
+func (a *Admin) startRecording(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Username string `json:"username"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Username == "" {
+		WriteError(w, http.StatusBadRequest, "username required")
+		return
+	}
+	if err := a.srv.Record(req.Username); err != nil {
+		WriteError(w, http.StatusConflict, err.Error())
+		return
+	}
+	logger.Info("Admin started recording username:%q", req.Username)
+	a.listRecordings(w, r)
+}
+
+func (a *Admin) stopRecording(w http.ResponseWriter, r *http.Request) {
+	username := r.URL.Query().Get("username")
+	if username == "" {
+		WriteError(w, http.StatusBadRequest, "username required")
+		return
+	}
+	a.srv.StopRecording(username)
+	a.listRecordings(w, r)
+}
+
+func WriteJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func WriteError(w http.ResponseWriter, status int, msg string) {
+	WriteJSON(w, status, map[string]string{"error": msg})
+}
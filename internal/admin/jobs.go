@@ -0,0 +1,31 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"luxor.tech/tcp_msg_processing_test/internal/jobsource"
+	"luxor.tech/tcp_msg_processing_test/pkg/logger"
+)
+
+// EnableTemplates expose the block template jobs derive from, a new one pushes a job right away
+func (a *Admin) EnableTemplates(template *jobsource.Template) {
+	a.mux.HandleFunc("GET /jobs/template", func(w http.ResponseWriter, _ *http.Request) {
+		WriteJSON(w, http.StatusOK, template.Current())
+	})
+	a.mux.HandleFunc("PUT /jobs/template", func(w http.ResponseWriter, r *http.Request) {
+		var req jobsource.BlockTemplate
+		decoder := json.NewDecoder(r.Body)
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&req); err != nil {
+			WriteError(w, http.StatusBadRequest, "invalid block template")
+			return
+		}
+		if err := template.Set(req); err != nil {
+			WriteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		logger.Info("Admin set block template, prev_hash:%s", req.PrevHash)
+		WriteJSON(w, http.StatusOK, template.Current())
+	})
+}
@@ -0,0 +1,17 @@
+package admin
+
+import (
+	"net/http"
+
+	"luxor.tech/tcp_msg_processing_test/internal/proxy"
+)
+
+// EnableProxy expose the upstream session and the per-username share statistics of a proxy
+func (a *Admin) EnableProxy(p *proxy.Proxy) {
+	a.mux.HandleFunc("GET /proxy/users", func(w http.ResponseWriter, _ *http.Request) {
+		WriteJSON(w, http.StatusOK, p.Users())
+	})
+	a.mux.HandleFunc("GET /proxy/upstream", func(w http.ResponseWriter, _ *http.Request) {
+		WriteJSON(w, http.StatusOK, map[string]bool{"connected": p.Connected()})
+	})
+}
@@ -0,0 +1,91 @@
+package admin
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"luxor.tech/tcp_msg_processing_test/internal/stats"
+	"luxor.tech/tcp_msg_processing_test/pkg/logger"
+)
+
+const maxTopUsers = 1000
+
+// EnableStats expose submission statistics queries
+func (a *Admin) EnableStats(svc *stats.Service) {
+	a.mux.HandleFunc("GET /stats/users/{username}", func(w http.ResponseWriter, r *http.Request) {
+		from, to, ok := window(w, r)
+		if !ok {
+			return
+		}
+		granularity, err := stats.ParseGranularity(r.URL.Query().Get("granularity"))
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		points, err := svc.UserSeries(r.Context(), r.PathValue("username"), from, to, granularity)
+		if err != nil {
+			queryFailed(w, err)
+			return
+		}
+		WriteJSON(w, http.StatusOK, points)
+	})
+	a.mux.HandleFunc("GET /stats/top", func(w http.ResponseWriter, r *http.Request) {
+		from, to, ok := window(w, r)
+		if !ok {
+			return
+		}
+		n := 10
+		if v := r.URL.Query().Get("n"); v != "" {
+			var err error
+			if n, err = strconv.Atoi(v); err != nil || n < 1 || n > maxTopUsers {
+				WriteError(w, http.StatusBadRequest, "n must be within 1-1000")
+				return
+			}
+		}
+		users, err := svc.TopUsers(r.Context(), from, to, n)
+		if err != nil {
+			queryFailed(w, err)
+			return
+		}
+		WriteJSON(w, http.StatusOK, users)
+	})
+	a.mux.HandleFunc("GET /stats/totals", func(w http.ResponseWriter, r *http.Request) {
+		from, to, ok := window(w, r)
+		if !ok {
+			return
+		}
+		totals, err := svc.Totals(r.Context(), from, to)
+		if err != nil {
+			queryFailed(w, err)
+			return
+		}
+		WriteJSON(w, http.StatusOK, totals)
+	})
+	a.mux.HandleFunc("GET /stats/rejections", func(w http.ResponseWriter, r *http.Request) {
+		from, to, ok := window(w, r)
+		if !ok {
+			return
+		}
+		users, err := svc.Rejections(r.Context(), r.URL.Query().Get("username"), from, to)
+		if err != nil {
+			queryFailed(w, err)
+			return
+		}
+		WriteJSON(w, http.StatusOK, users)
+	})
+}
+
+func window(w http.ResponseWriter, r *http.Request) (time.Time, time.Time, bool) {
+	from, to, err := stats.ParseWindow(r.URL.Query().Get("from"), r.URL.Query().Get("to"), time.Now())
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err.Error())
+		return from, to, false
+	}
+	return from, to, true
+}
+
+func queryFailed(w http.ResponseWriter, err error) {
+	logger.Error("Stats query failed: %v", err)
+	WriteError(w, http.StatusServiceUnavailable, "stats query failed")
+}
@@ -4,15 +4,20 @@ import (
 	"bufio"
 	"context"
 	"crypto/rand"
-	"crypto/sha256"
-	"encoding/hex"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"math/big"
 	"net"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"luxor.tech/tcp_msg_processing_test/internal/protocol"
+	"luxor.tech/tcp_msg_processing_test/pkg/clock"
 	"luxor.tech/tcp_msg_processing_test/pkg/logger"
 	"luxor.tech/tcp_msg_processing_test/pkg/util"
 )
@@ -22,31 +27,81 @@ type Client struct {
 	serverAddr string
 	username   string
 	conn       net.Conn
+	reader     *bufio.Reader
+	pushed     []*Request           // server requests read while waiting for a response
+	readMu     sync.Mutex           // reader and pushed, one goroutine reads at a time
+	job        atomic.Pointer[Task] // latest job, auto submission works on it
+	tlsConfig  *TLSConfig
+	wsURL      string
+	lastSend   atomic.Int64 // unix nano of last outbound message
+	clock      clock.Clock
 
 	// submission rate
-	lastSubmit  time.Time
+	lastSubmit  atomic.Int64 // unix nano of last submission
 	minInterval time.Duration
 	maxInterval time.Duration
+
+	// keepalive
+	idleTimeout  time.Duration
+	pingInterval time.Duration
+	tcpKeepAlive time.Duration
 }
 
 func NewClient(serverAddr, username string, minInterval, maxInterval time.Duration) *Client {
 	return &Client{
 		serverAddr: serverAddr,
 		username:   username,
+		clock:      clock.Real,
 
 		// submission rate
 		minInterval: minInterval,
 		maxInterval: maxInterval,
+
+		// keepalive
+		idleTimeout:  time.Second * 90,
+		pingInterval: time.Second * 30,
+		tcpKeepAlive: time.Second * 15,
 	}
 }
 
+// SetKeepalive configures liveness detection, zero disables the related check.
+// idleTimeout: give up the connection when nothing received from server within
+// pingInterval: ping the server when nothing sent within
+func (c *Client) SetKeepalive(idleTimeout, pingInterval, tcpKeepAlive time.Duration) {
+	c.idleTimeout = idleTimeout
+	c.pingInterval = pingInterval
+	c.tcpKeepAlive = tcpKeepAlive
+}
+
+// SetClock replace the wall clock driving submission pacing and keepalive, call before connecting
+func (c *Client) SetClock(clk clock.Clock) {
+	c.clock = clk
+}
+
 func (c *Client) Connect() error {
-	conn, err := net.Dial("tcp", c.serverAddr)
+	dialer := &net.Dialer{KeepAlive: c.tcpKeepAlive}
+	var conn net.Conn
+	var err error
+	if c.wsURL != "" {
+		conn, err = c.dialWebSocket(dialer)
+	} else if c.tlsConfig != nil {
+		tlsConfig, e := c.tlsConfig.build()
+		if e != nil {
+			return e
+		}
+		conn, err = tls.DialWithDialer(dialer, "tcp", c.serverAddr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", c.serverAddr)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to connect to server: %v", err)
 	}
 	c.conn = conn
-	logger.Info("Connected to server:%v", c.serverAddr)
+	c.readMu.Lock()
+	c.reader = bufio.NewReader(conn)
+	c.pushed = nil
+	c.readMu.Unlock()
+	logger.Info("Connected to server:%v", conn.RemoteAddr())
 	return nil
 }
 
@@ -58,21 +113,20 @@ func (c *Client) Authorize() error {
 	authorizeRequest := Request{
 		ID:     util.GenerateID(),
 		Method: "authorize",
-		Params: map[string]interface{}{
-			"username": c.username,
-		},
+		Params: protocol.Encode(&protocol.AuthorizeParams{Username: c.username}),
 	}
 
-	data, _ := json.Marshal(authorizeRequest)
-	_, err := c.conn.Write(append(data, '\n'))
+	sentAt := time.Now()
+	err := c.send(authorizeRequest)
 	if err != nil {
 		logger.Error("Failed to send authorize request:%v", err)
 		return fmt.Errorf("failed to send authorize request: %v", err)
 	}
-	response, err := c.ReadServerResponse()
+	response, err := c.readResponse(authorizeRequest.ID)
 	if err != nil {
 		return err
 	}
+	roundTripDuration.WithLabelValues("authorize").Observe(time.Since(sentAt).Seconds())
 	if !response.Result {
 		logger.Error("Authorization failed: %s", response.Error)
 		return fmt.Errorf("authorization failed: %s", response.Error)
@@ -89,6 +143,11 @@ func (c *Client) ReceiveTasks(ctx context.Context) {
 			return
 		default:
 			err := c.ReceiveTask(ctx)
+			var netErr net.Error
+			if errors.Is(err, io.EOF) || errors.As(err, &netErr) {
+				logger.Error("Connection to server lost: %v", err)
+				return
+			}
 			if err != nil {
 				logger.Error("Failed to receive task: %v", err)
 			}
@@ -100,18 +159,19 @@ func (c *Client) ReceiveTask(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
-	logger.Info("Received task: %v", req)
+	logger.Debug("Received task: %v", req)
 	// Handle the task
 	if req.Method == "job" {
-		var taskInfo Task
-		tb, _ := json.Marshal(req.Params)
-		_ = json.Unmarshal(tb, &taskInfo)
+		taskInfo, err := req.Job()
+		if err != nil {
+			return fmt.Errorf("invalid job: %v", err)
+		}
 
 		jobID := taskInfo.JobID
-		serverNonce := taskInfo.ServerNonce
-		logger.Info("New task received: job_id=%d, server_nonce=%s", jobID, serverNonce)
+		c.job.Store(&taskInfo)
+		logger.Info("New task received: job_id=%d, server_nonce=%s, extranonce=%s, clean_jobs=%v", jobID, taskInfo.ServerNonce, taskInfo.Extranonce, taskInfo.CleanJobs)
 		// task computation and submit the result
-		clientNonce, result := c.CalculateResult(serverNonce)
+		clientNonce, result := c.CalculateResult(taskInfo)
 		if result == "" {
 			return fmt.Errorf("failed to calculate result")
 		}
@@ -123,28 +183,56 @@ func (c *Client) ReceiveTask(ctx context.Context) error {
 		if response.Result {
 			logger.Info("Result submitted successfully for job_id:%v, user:%s", jobID, c.username)
 		} else {
-			logger.Error("Result submission failed for job_id:%v", jobID, response.Error)
+			logger.Error("Result submission failed for job_id:%v, err:%s", jobID, response.Error)
 		}
 	}
+	if req.Method == "ping" {
+		return c.Pong(req.ID)
+	}
 
 	return nil
 }
 func (c *Client) ReceiveRequest() (*Request, error) {
-	reader := bufio.NewReader(c.conn)
-	message, err := reader.ReadString('\n')
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+	if len(c.pushed) > 0 {
+		task := c.pushed[0]
+		c.pushed = c.pushed[1:]
+		return task, nil
+	}
+	message, err := c.readMessage()
 	if err != nil {
 		logger.Error("Error reading from server:%v", err)
 		return nil, err
 	}
 
-	message = strings.TrimSpace(message)
-
 	var task Request
 	err = json.Unmarshal([]byte(message), &task)
 	return &task, err
 }
 
-func (c *Client) CalculateResult(serverNonce string) (string, string) {
+// PendingRequests take the server requests (jobs, pings) that arrived while waiting for responses
+func (c *Client) PendingRequests() []*Request {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+	pushed := c.pushed
+	c.pushed = nil
+	return pushed
+}
+
+// readMessage read one line from the server, readMu must be held
+func (c *Client) readMessage() (string, error) {
+	if c.idleTimeout > 0 {
+		_ = c.conn.SetReadDeadline(time.Now().Add(c.idleTimeout))
+	}
+	message, err := c.reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(message), nil
+}
+
+func (c *Client) CalculateResult(task Task) (string, string) {
 	// Ensure the client is connected
 	if c.conn == nil {
 		return "", ""
@@ -153,13 +241,13 @@ func (c *Client) CalculateResult(serverNonce string) (string, string) {
 	// Generate client_nonce
 	clientNonce, err := GenerateClientNonce(16)
 	if err != nil {
-		logger.Error("Failed to generate client_nonce:", err)
+		logger.Error("Failed to generate client_nonce:%v", err)
 		return "", ""
 	}
-	// Calculate SHA256(server_nonce + client_nonce)
-	hashInput := serverNonce + clientNonce
-	hash := sha256.Sum256([]byte(hashInput))
-	result := hex.EncodeToString(hash[:])
+	// Calculate SHA256(server_nonce + extranonce + client_nonce)
+	result := task.Result(clientNonce)
+	hashesTotal.Inc()
+	hashes.Add(1)
 	return clientNonce, result
 }
 
@@ -168,33 +256,120 @@ func (c *Client) Submit(jobID int, clientNonce, result string, limit bool) (*Res
 	submitRequest := Request{
 		ID:     util.GenerateID(),
 		Method: "submit",
-		Params: map[string]interface{}{
-			"job_id":       jobID,
-			"client_nonce": clientNonce,
-			"result":       result,
-		},
+		Params: protocol.Encode(&protocol.SubmitParams{JobID: jobID, ClientNonce: clientNonce, Result: result}),
 	}
 
 	// Enforce submission rate
 	if limit {
-		if !c.lastSubmit.IsZero() {
-			timeSinceLast := time.Now().Sub(c.lastSubmit)
+		if last := c.lastSubmit.Load(); last != 0 {
+			timeSinceLast := c.clock.Since(time.Unix(0, last))
 			if timeSinceLast < c.minInterval {
-				time.Sleep(c.minInterval - timeSinceLast)
+				c.clock.Sleep(c.minInterval - timeSinceLast)
 			}
 		}
 	}
-	c.lastSubmit = time.Now()
+	c.lastSubmit.Store(c.clock.Now().UnixNano())
 
 	// Serialize to JSON and send to server
-	data, _ := json.Marshal(submitRequest)
-	_, err := c.conn.Write(append(data, '\n'))
+	sentAt := time.Now()
+	err := c.send(submitRequest)
 	if err != nil {
 		logger.Error("Failed to send submission request:%v", err)
 		return nil, err
 	}
 
-	return c.ReadServerResponse()
+	response, err := c.readResponse(submitRequest.ID)
+	if err != nil {
+		return nil, err
+	}
+	roundTripDuration.WithLabelValues("submit").Observe(time.Since(sentAt).Seconds())
+	if response.Result {
+		sharesTotal.WithLabelValues("accepted").Inc()
+	} else {
+		sharesTotal.WithLabelValues("rejected").Inc()
+	}
+	return response, nil
+}
+
+// SendSubmit send a submission with id without waiting for its response, which then comes from ReceiveMessage.
+// Unlike Submit it may be called while another goroutine reads, and the submission rate is up to the caller
+func (c *Client) SendSubmit(id, jobID int, clientNonce, result string) error {
+	if c.conn == nil {
+		return fmt.Errorf("no active connection")
+	}
+	c.lastSubmit.Store(c.clock.Now().UnixNano())
+	return c.send(Request{
+		ID:     &id,
+		Method: "submit",
+		Params: protocol.Encode(&protocol.SubmitParams{JobID: jobID, ClientNonce: clientNonce, Result: result}),
+	})
+}
+
+// ReceiveMessage read the next server request or response, whichever comes first, exactly one is returned
+func (c *Client) ReceiveMessage() (*Request, *Response, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+	if len(c.pushed) > 0 {
+		req := c.pushed[0]
+		c.pushed = c.pushed[1:]
+		return req, nil, nil
+	}
+	message, err := c.readMessage()
+	if err != nil {
+		return nil, nil, err
+	}
+	var req Request
+	if err := json.Unmarshal([]byte(message), &req); err == nil && req.Method != "" {
+		return &req, nil, nil
+	}
+	var resp Response
+	if err := json.Unmarshal([]byte(message), &resp); err != nil {
+		return nil, nil, fmt.Errorf("invalid JSON message: %v", err)
+	}
+	return nil, &resp, nil
+}
+
+// Pong answer a ping of the server with id
+func (c *Client) Pong(id *int) error {
+	return c.send(Request{ID: id, Method: "pong"})
+}
+
+// Ping send a ping, the pong reply is consumed by ReceiveTask
+func (c *Client) Ping() error {
+	if c.conn == nil {
+		return fmt.Errorf("no active connection")
+	}
+	return c.send(Request{ID: util.GenerateID(), Method: "ping"})
+}
+
+// StartKeepalive ping the server whenever nothing was sent within pingInterval
+func (c *Client) StartKeepalive(ctx context.Context) {
+	if c.pingInterval <= 0 {
+		return
+	}
+	ticker := c.clock.NewTicker(c.pingInterval / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			if c.clock.Since(time.Unix(0, c.lastSend.Load())) >= c.pingInterval {
+				if err := c.Ping(); err != nil {
+					logger.Error("Failed to ping server:%v", err)
+				}
+			}
+		}
+	}
+}
+
+func (c *Client) send(req Request) error {
+	data, _ := json.Marshal(req)
+	_, err := c.conn.Write(append(data, '\n'))
+	if err == nil {
+		c.lastSend.Store(c.clock.Now().UnixNano())
+	}
+	return err
 }
 
 func GenerateClientNonce(length int) (string, error) {
@@ -210,35 +385,62 @@ func GenerateClientNonce(length int) (string, error) {
 	return string(result), nil
 }
 
+// ReadServerResponse read the next response, server requests read meanwhile are kept for ReceiveRequest
 func (c *Client) ReadServerResponse() (*Response, error) {
-	reader := bufio.NewReader(c.conn)
-	response, err := reader.ReadString('\n')
-	if err != nil {
-		return nil, err
-	}
+	return c.readResponse(nil)
+}
 
-	response = strings.TrimSpace(response)
-	var result Response
-	err = json.Unmarshal([]byte(response), &result)
-	if err != nil {
-		return nil, fmt.Errorf("invalid JSON response: %v", err)
+// readResponse read the response to the request with id, or the next one when id is nil. Responses to other
+// requests, such as auto submissions sent without waiting, are dropped
+func (c *Client) readResponse(id *int) (*Response, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+	for {
+		message, err := c.readMessage()
+		if err != nil {
+			return nil, err
+		}
+		var req Request
+		if err := json.Unmarshal([]byte(message), &req); err == nil && req.Method != "" {
+			c.pushed = append(c.pushed, &req)
+			continue
+		}
+
+		var result Response
+		err = json.Unmarshal([]byte(message), &result)
+		if err != nil {
+			return nil, fmt.Errorf("invalid JSON response: %v", err)
+		}
+		if id != nil && result.ID != nil && *result.ID != *id {
+			logger.Debug("Dropped response to request %d: %v", *result.ID, result)
+			continue
+		}
+		return &result, nil
 	}
-	return &result, nil
 }
 
+// StartAutoSubmission submit a share of the latest job whenever nothing was submitted within maxInterval. It only
+// writes, the response is read and dropped by the goroutine receiving tasks
 func (c *Client) StartAutoSubmission(ctx context.Context) {
-	ticker := time.NewTicker(c.maxInterval)
+	if c.maxInterval <= 0 {
+		return
+	}
+	ticker := c.clock.NewTicker(c.maxInterval / 2)
 	defer ticker.Stop()
 	for {
 		select {
 		case <-ctx.Done():
 			logger.Info("Stopping auto submission...")
 			return
-		case <-ticker.C:
-			// Ensure at least one submission per minute
-			if time.Since(c.lastSubmit) > time.Minute {
-				_, _ = c.Submit(0, "", "", true) // job_id=0 for auto-submission
-			}
+		case <-ticker.C():
+		}
+		job := c.job.Load()
+		if job == nil || c.clock.Since(time.Unix(0, c.lastSubmit.Load())) < c.maxInterval {
+			continue
+		}
+		clientNonce, result := c.CalculateResult(*job)
+		if err := c.SendSubmit(*util.GenerateID(), job.JobID, clientNonce, result); err != nil {
+			logger.Error("Failed to send auto submission:%v", err)
 		}
 	}
 }
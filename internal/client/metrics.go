@@ -0,0 +1,67 @@
+package client
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	hashesTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "tcpmsg_client_hashes_total",
+		Help: "Hashes calculated since start.",
+	})
+	_ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "tcpmsg_client_hashrate",
+		Help: "Hashes per second over the last minute.",
+	}, hashes.Rate)
+	roundTripDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "tcpmsg_client_round_trip_seconds",
+		Help:    "Request to response latency by method.",
+		Buckets: prometheus.ExponentialBuckets(0.0005, 4, 8),
+	}, []string{"method"})
+	sharesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "tcpmsg_client_shares_total",
+		Help: "Submitted shares by result.",
+	}, []string{"result"})
+)
+
+var hashes = &rateMeter{window: time.Minute}
+
+// rateMeter events per second over the previous full window
+type rateMeter struct {
+	window time.Duration
+	start  time.Time
+	count  float64
+	last   float64
+	mu     sync.Mutex
+}
+
+func (m *rateMeter) Add(n float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.roll(time.Now())
+	m.count += n
+}
+
+func (m *rateMeter) Rate() float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.roll(time.Now())
+	return m.last
+}
+
+func (m *rateMeter) roll(now time.Time) {
+	elapsed := now.Sub(m.start)
+	if elapsed < m.window {
+		return
+	}
+	if elapsed < 2*m.window {
+		m.last = m.count / elapsed.Seconds()
+	} else {
+		m.last = 0 // idle for a whole window
+	}
+	m.start, m.count = now, 0
+}
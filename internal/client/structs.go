@@ -1,15 +1,26 @@
 package client
 
+import (
+	"encoding/json"
+
+	"luxor.tech/tcp_msg_processing_test/internal/protocol"
+)
+
 type Request struct {
-	ID     *int                   `json:"id,omitempty"`
-	Method string                 `json:"method"`
-	Params map[string]interface{} `json:"params"`
+	ID     *int            `json:"id,omitempty"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"` // decoded per method with protocol.Decode
 }
-type Task struct {
-	JobID       int    `json:"job_id"`
-	ServerNonce string `json:"server_nonce"`
+
+// Job params of a job request, strictly validated
+func (r *Request) Job() (Task, error) {
+	var task Task
+	err := protocol.Decode(r.Params, &task)
+	return task, err
 }
 
+type Task = protocol.JobParams
+
 type Response struct {
 	ID     *int   `json:"id"`
 	Result bool   `json:"result"`
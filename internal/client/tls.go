@@ -0,0 +1,45 @@
+package client
+
+import (
+	"crypto/tls"
+	"fmt"
+
+	"luxor.tech/tcp_msg_processing_test/pkg/util"
+)
+
+// TLSConfig dialer TLS settings
+type TLSConfig struct {
+	CAFile             string // CA bundle verifying the server, system roots when empty
+	ServerName         string // defaults to the host of serverAddr
+	CertFile           string // client certificate for mutual tls
+	KeyFile            string
+	InsecureSkipVerify bool // lab use only
+}
+
+// SetTLS dial the server over TLS, nil reverts to plaintext
+func (c *Client) SetTLS(cfg *TLSConfig) {
+	c.tlsConfig = cfg
+}
+
+func (cfg *TLSConfig) build() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+	if cfg.CAFile != "" {
+		pool, err := util.LoadCertPool(cfg.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client key pair: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
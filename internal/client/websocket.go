@@ -0,0 +1,41 @@
+package client
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"luxor.tech/tcp_msg_processing_test/pkg/wsconn"
+)
+
+// SetWebSocket connect through a websocket url (ws:// or wss://) instead of raw tcp,
+// HTTP(S)_PROXY from the environment is honored. Empty url reverts to tcp.
+func (c *Client) SetWebSocket(url string) {
+	c.wsURL = url
+}
+
+func (c *Client) dialWebSocket(dialer *net.Dialer) (net.Conn, error) {
+	wsDialer := websocket.Dialer{
+		NetDialContext:   dialer.DialContext,
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: time.Second * 10,
+	}
+	if c.tlsConfig != nil {
+		tlsConfig, err := c.tlsConfig.build()
+		if err != nil {
+			return nil, err
+		}
+		wsDialer.TLSClientConfig = tlsConfig
+	}
+	ws, resp, err := wsDialer.Dial(c.wsURL, nil)
+	if err != nil {
+		if resp != nil {
+			return nil, fmt.Errorf("%v, status:%s", err, resp.Status)
+		}
+		return nil, err
+	}
+	return wsconn.New(ws), nil
+}
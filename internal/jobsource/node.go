@@ -0,0 +1,81 @@
+package jobsource
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"luxor.tech/tcp_msg_processing_test/pkg/clock"
+	"luxor.tech/tcp_msg_processing_test/pkg/logger"
+)
+
+// GenesisBits difficulty bits of the first template of a Node
+const GenesisBits = 0x1d00ffff
+
+// Node local stand-in for an upstream node: a chain of block templates with fresh merkle roots, advanced by NewBlock.
+// Jobs are those of the current tip
+type Node struct {
+	*Template
+	clock  clock.Clock
+	height uint64
+	mu     sync.Mutex
+}
+
+func NewNode(clk clock.Clock) *Node {
+	n := &Node{clock: clk}
+	n.Template, _ = NewTemplate(BlockTemplate{
+		Version:    1,
+		PrevHash:   hex.EncodeToString(make([]byte, 32)),
+		MerkleRoot: randomHash(),
+		NTime:      uint32(clk.Now().Unix()),
+		NBits:      GenesisBits,
+	})
+	return n
+}
+
+// NewBlock extend the chain on top of the current template, returns the new one
+func (n *Node) NewBlock() BlockTemplate {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	tip := n.Current()
+	prevHash, _ := tip.BlockHash(0)
+	next := BlockTemplate{
+		Version:    tip.Version,
+		PrevHash:   prevHash,
+		MerkleRoot: randomHash(),
+		NTime:      max(uint32(n.clock.Now().Unix()), tip.NTime+1),
+		NBits:      tip.NBits,
+	}
+	_ = n.Set(next) // hashes are generated, always valid
+	n.height++
+	logger.Debugw("New block template", "height", n.height, "prev_hash", prevHash)
+	return next
+}
+
+// Height blocks added since the first template
+func (n *Node) Height() uint64 {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.height
+}
+
+// Run add a block every interval until done is closed
+func (n *Node) Run(interval time.Duration, done <-chan struct{}) {
+	ticker := n.clock.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C():
+			n.NewBlock()
+		}
+	}
+}
+
+func randomHash() string {
+	hash := make([]byte, 32)
+	_, _ = rand.Read(hash)
+	return hex.EncodeToString(hash)
+}
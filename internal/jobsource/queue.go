@@ -0,0 +1,112 @@
+package jobsource
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"luxor.tech/tcp_msg_processing_test/internal/protocol"
+	"luxor.tech/tcp_msg_processing_test/internal/server"
+)
+
+var ErrNoJob = errors.New("no job queued yet")
+
+// Queue JobSource handing out pushed jobs in order, the last one is repeated once drained. Push signals a change
+type Queue struct {
+	jobs    []server.Job
+	last    server.Job
+	started bool // a job was handed out, last is set
+	changes chan struct{}
+	mu      sync.Mutex
+}
+
+func NewQueue() *Queue {
+	return &Queue{changes: make(chan struct{}, 1)}
+}
+
+// Push a job behind the queued ones, its server nonce must be valid on the wire
+func (q *Queue) Push(job server.Job) error {
+	params := protocol.JobParams{JobID: 1, ServerNonce: job.ServerNonce}
+	if err := params.Validate(); err != nil {
+		return err
+	}
+	q.mu.Lock()
+	q.jobs = append(q.jobs, job)
+	q.mu.Unlock()
+	notify(q.changes)
+	return nil
+}
+
+func (q *Queue) JobChanges() <-chan struct{} {
+	return q.changes
+}
+
+// Len jobs queued and not handed out yet
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.jobs)
+}
+
+func (q *Queue) NextJob() (server.Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.jobs) > 0 {
+		q.last, q.jobs, q.started = q.jobs[0], q.jobs[1:], true
+	}
+	if !q.started {
+		return server.Job{}, ErrNoJob
+	}
+	return q.last, nil
+}
+
+// NewFileQueue queue the jobs of a file, one per line: a JSON BlockTemplate or a bare server nonce.
+// Blank lines and lines starting with # are skipped
+func NewFileQueue(path string) (*Queue, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	q := NewQueue()
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		job, err := parseJob(text)
+		if err == nil {
+			err = q.Push(job)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if q.Len() == 0 {
+		return nil, fmt.Errorf("%s: no job", path)
+	}
+	return q, nil
+}
+
+func parseJob(text string) (server.Job, error) {
+	if !strings.HasPrefix(text, "{") {
+		return server.Job{ServerNonce: text}, nil
+	}
+	var template BlockTemplate
+	decoder := json.NewDecoder(strings.NewReader(text))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&template); err != nil {
+		return server.Job{}, fmt.Errorf("invalid block template: %v", err)
+	}
+	nonce, err := template.ServerNonce()
+	return server.Job{ServerNonce: nonce, Tip: template.PrevHash}, err
+}
@@ -0,0 +1,139 @@
+// Package jobsource origins of jobs besides the default random nonces: block templates, queues fed from a file, and a
+// local stand-in for an upstream node
+package jobsource
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sync"
+
+	"luxor.tech/tcp_msg_processing_test/internal/server"
+)
+
+// BlockTemplate header fields a job derives from, hashes are hex in the usual display (byte reversed) order
+type BlockTemplate struct {
+	Version    uint32 `json:"version"`
+	PrevHash   string `json:"prev_hash"`
+	MerkleRoot string `json:"merkle_root"`
+	NTime      uint32 `json:"ntime"`
+	NBits      uint32 `json:"nbits"`
+}
+
+// Header 76 byte block header without its nonce: little endian fields, hashes in internal byte order
+func (t BlockTemplate) Header() ([]byte, error) {
+	prevHash, err := decodeHash("prev_hash", t.PrevHash)
+	if err != nil {
+		return nil, err
+	}
+	merkleRoot, err := decodeHash("merkle_root", t.MerkleRoot)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, 0, 80)
+	header = binary.LittleEndian.AppendUint32(header, t.Version)
+	header = append(header, prevHash...)
+	header = append(header, merkleRoot...)
+	header = binary.LittleEndian.AppendUint32(header, t.NTime)
+	header = binary.LittleEndian.AppendUint32(header, t.NBits)
+	return header, nil
+}
+
+// ServerNonce hex double SHA256 of the header, distinct for every template
+func (t BlockTemplate) ServerNonce() (string, error) {
+	header, err := t.Header()
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(sha256d(header)), nil
+}
+
+// BlockHash display hash of the block closed with nonce
+func (t BlockTemplate) BlockHash(nonce uint32) (string, error) {
+	header, err := t.Header()
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(reverse(sha256d(binary.LittleEndian.AppendUint32(header, nonce)))), nil
+}
+
+// Template JobSource of the current block template, every job carries it until Set replaces it. A template with
+// another prev hash makes a clean job
+type Template struct {
+	template BlockTemplate
+	job      server.Job
+	changes  chan struct{}
+	mu       sync.RWMutex
+}
+
+func NewTemplate(template BlockTemplate) (*Template, error) {
+	t := &Template{changes: make(chan struct{}, 1)}
+	if err := t.Set(template); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Set the template of the following jobs, a different one signals a change
+func (t *Template) Set(template BlockTemplate) error {
+	nonce, err := template.ServerNonce()
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	changed := t.job.ServerNonce != nonce
+	t.template, t.job = template, server.Job{ServerNonce: nonce, Tip: template.PrevHash}
+	t.mu.Unlock()
+	if changed {
+		notify(t.changes)
+	}
+	return nil
+}
+
+func (t *Template) JobChanges() <-chan struct{} {
+	return t.changes
+}
+
+func (t *Template) Current() BlockTemplate {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.template
+}
+
+func (t *Template) NextJob() (server.Job, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.job, nil
+}
+
+// notify signal a change without blocking, pending signals are coalesced
+func notify(changes chan struct{}) {
+	select {
+	case changes <- struct{}{}:
+	default:
+	}
+}
+
+func sha256d(data []byte) []byte {
+	first := sha256.Sum256(data)
+	second := sha256.Sum256(first[:])
+	return second[:]
+}
+
+func decodeHash(field, value string) ([]byte, error) {
+	hash, err := hex.DecodeString(value)
+	if err != nil || len(hash) != sha256.Size {
+		return nil, fmt.Errorf("invalid %s: must be %d hex digits", field, sha256.Size*2)
+	}
+	return reverse(hash), nil
+}
+
+// reverse a copy of b, hashes are displayed byte reversed
+func reverse(b []byte) []byte {
+	out := make([]byte, len(b))
+	for i := range b {
+		out[len(b)-1-i] = b[i]
+	}
+	return out
+}
@@ -0,0 +1,63 @@
+package jobsource
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"luxor.tech/tcp_msg_processing_test/pkg/clock"
+	"luxor.tech/tcp_msg_processing_test/pkg/logger"
+)
+
+// LoadTemplate read a JSON BlockTemplate file
+func LoadTemplate(path string) (BlockTemplate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return BlockTemplate{}, err
+	}
+	var template BlockTemplate
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&template); err != nil {
+		return BlockTemplate{}, fmt.Errorf("%s: invalid block template: %v", path, err)
+	}
+	if _, err := template.ServerNonce(); err != nil {
+		return BlockTemplate{}, fmt.Errorf("%s: %v", path, err)
+	}
+	return template, nil
+}
+
+// WatchTemplate poll path every interval until done is closed and Set the template it holds whenever the file
+// changes, so writing a new template pushes a job. Invalid or partially written files are retried on the next poll
+func WatchTemplate(path string, template *Template, clk clock.Clock, interval time.Duration, done <-chan struct{}) {
+	var modTime time.Time // of the file last loaded, the first poll loads it, an unchanged template is no change
+	var size int64
+	ticker := clk.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C():
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			logger.Warnw("Failed to watch block template", "path", path, "err", err)
+			continue
+		}
+		if info.ModTime().Equal(modTime) && info.Size() == size {
+			continue
+		}
+		next, err := LoadTemplate(path)
+		if err != nil {
+			logger.Warnw("Ignoring block template", "path", path, "err", err)
+			continue
+		}
+		modTime, size = info.ModTime(), info.Size()
+		if next != template.Current() && template.Set(next) == nil {
+			logger.Info("Loaded block template %s, prev_hash:%s", path, next.PrevHash)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package loadgen
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"luxor.tech/tcp_msg_processing_test/internal/client"
+	"luxor.tech/tcp_msg_processing_test/internal/protocol"
+)
+
+type Config struct {
+	Addr       string
+	Clients    int
+	Ramp       time.Duration // clients connect evenly over this period
+	Duration   time.Duration // whole run including the ramp
+	Rate       float64       // shares per second of each paced client
+	Invalid    float64       // fraction of shares with a wrong result
+	Duplicate  float64       // fraction of shares resubmitting the previous nonce
+	Flooders   float64       // fraction of clients submitting back to back, ignoring Rate
+	UserPrefix string
+	JobWait    time.Duration // time a client waits for its first job
+
+	AdminURL   string // when set, each client gets a job right after authorize through POST /jobs
+	AdminToken string
+	MetricsURL string // server /metrics scraped for resource usage, skipped when empty
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Addr:       "localhost:8888",
+		Clients:    1000,
+		Ramp:       time.Second * 10,
+		Duration:   time.Minute,
+		Rate:       0.5, // server rate limit is one share per second
+		UserPrefix: "loadgen",
+		JobWait:    time.Second * 35,
+	}
+}
+
+func (cfg Config) validate() error {
+	switch {
+	case cfg.Clients < 1:
+		return fmt.Errorf("clients must be positive")
+	case cfg.Rate <= 0:
+		return fmt.Errorf("rate must be positive")
+	case cfg.Duration <= cfg.Ramp:
+		return fmt.Errorf("duration must exceed ramp")
+	case cfg.Invalid < 0 || cfg.Duplicate < 0 || cfg.Invalid+cfg.Duplicate > 1:
+		return fmt.Errorf("invalid and duplicate fractions must be within 0-1 together")
+	case cfg.Flooders < 0 || cfg.Flooders > 1:
+		return fmt.Errorf("flooders fraction must be within 0-1")
+	}
+	return nil
+}
+
+// workerStats outcomes of one client, merged into the report once it stops
+type workerStats struct {
+	connected, authorized, gotJob bool
+	sent                          map[string]int64 // valid, invalid, duplicate
+	accepted                      int64
+	rejections                    map[string]int64
+	errors                        int64
+	latencies                     []time.Duration
+}
+
+// Run drive cfg.Clients simulated miners against the server until cfg.Duration or ctx ends
+func Run(ctx context.Context, cfg Config) (*Report, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, cfg.Duration)
+	defer cancel()
+
+	var sampler *usageSampler
+	if cfg.MetricsURL != "" {
+		sampler = newUsageSampler(cfg.MetricsURL)
+		if err := sampler.sample(); err != nil {
+			return nil, fmt.Errorf("scrape server metrics: %v", err)
+		}
+		go sampler.run(ctx, time.Second)
+	}
+
+	started := time.Now()
+	results := make(chan *workerStats, cfg.Clients)
+	var wg sync.WaitGroup
+	floodEvery := 0
+	if cfg.Flooders > 0 {
+		floodEvery = int(1 / cfg.Flooders)
+	}
+	for i := 0; i < cfg.Clients; i++ {
+		if i > 0 && cfg.Ramp > 0 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(cfg.Ramp / time.Duration(cfg.Clients)):
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			flood := floodEvery > 0 && id%floodEvery == 0
+			results <- runWorker(ctx, cfg, id, flood)
+		}(i)
+	}
+	wg.Wait()
+	close(results)
+	elapsed := time.Since(started)
+
+	report := newReport(cfg, elapsed)
+	latencies := make([]time.Duration, 0)
+	for stats := range results {
+		report.add(stats)
+		latencies = append(latencies, stats.latencies...)
+	}
+	report.Latency = summarize(latencies)
+	if sampler != nil {
+		if err := sampler.sample(); err == nil {
+			report.Server = sampler.usage(elapsed)
+		}
+	}
+	return report, nil
+}
+
+func runWorker(ctx context.Context, cfg Config, id int, flood bool) *workerStats {
+	stats := &workerStats{sent: make(map[string]int64), rejections: make(map[string]int64)}
+	username := fmt.Sprintf("%s-%d", cfg.UserPrefix, id)
+	c := client.NewClient(cfg.Addr, username, 0, time.Minute)
+	c.SetKeepalive(cfg.JobWait, 0, time.Second*15)
+	if err := c.Connect(); err != nil {
+		return stats
+	}
+	stats.connected = true
+	stop := context.AfterFunc(ctx, c.Close) // unblock pending reads once the run ends
+	defer stop()
+	defer c.Close()
+
+	if err := c.Authorize(); err != nil {
+		return stats
+	}
+	stats.authorized = true
+	if cfg.AdminURL != "" {
+		_ = requestJob(ctx, cfg, username)
+	}
+
+	var job client.Task
+	for job.ServerNonce == "" {
+		req, err := c.ReceiveRequest()
+		if err != nil {
+			return stats
+		}
+		if req.Method == "job" {
+			job, _ = req.Job()
+		}
+	}
+	stats.gotJob = true
+
+	rng := rand.New(rand.NewSource(int64(id) + time.Now().UnixNano()))
+	interval := time.Duration(float64(time.Second) / cfg.Rate)
+	next := time.Now()
+	var lastNonce, lastResult string
+	for ctx.Err() == nil {
+		if !flood {
+			next = next.Add(interval)
+			select {
+			case <-ctx.Done():
+				return stats
+			case <-time.After(time.Until(next)):
+			}
+		}
+
+		kind, clientNonce, result := "valid", "", ""
+		switch roll := rng.Float64(); {
+		case lastNonce != "" && roll < cfg.Duplicate:
+			kind, clientNonce, result = "duplicate", lastNonce, lastResult
+		case roll < cfg.Duplicate+cfg.Invalid:
+			kind = "invalid"
+			clientNonce, result = c.CalculateResult(job)
+			result = protocol.CorruptResult(result)
+		default:
+			clientNonce, result = c.CalculateResult(job)
+		}
+
+		sentAt := time.Now()
+		resp, err := c.Submit(job.JobID, clientNonce, result, false)
+		if err != nil {
+			if ctx.Err() == nil {
+				stats.errors++
+			}
+			return stats
+		}
+		stats.latencies = append(stats.latencies, time.Since(sentAt))
+		stats.sent[kind]++
+		if resp.Result {
+			stats.accepted++
+			lastNonce, lastResult = clientNonce, result
+		} else {
+			stats.rejections[resp.Error]++
+		}
+
+		for _, req := range c.PendingRequests() {
+			if next, err := req.Job(); req.Method == "job" && err == nil {
+				job = next
+			}
+		}
+	}
+	return stats
+}
+
+// requestJob ask the admin api to send username a job now
+func requestJob(ctx context.Context, cfg Config, username string) error {
+	body, _ := json.Marshal(map[string]string{"username": username})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.AdminURL+"/jobs", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+cfg.AdminToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("admin api: %s", resp.Status)
+	}
+	return nil
+}
+
+// Percentile nearest-rank percentile p (0-100] of sorted durations, 0 when empty
+func Percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(p/100*float64(len(sorted)) + 0.999999999)
+	if rank < 1 {
+		rank = 1
+	}
+	if rank > len(sorted) {
+		rank = len(sorted)
+	}
+	return sorted[rank-1]
+}
+
+func summarize(latencies []time.Duration) Latency {
+	if len(latencies) == 0 {
+		return Latency{}
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	var total time.Duration
+	for _, l := range latencies {
+		total += l
+	}
+	return Latency{
+		Mean: millis(total / time.Duration(len(latencies))),
+		P50:  millis(Percentile(latencies, 50)),
+		P90:  millis(Percentile(latencies, 90)),
+		P99:  millis(Percentile(latencies, 99)),
+		Max:  millis(latencies[len(latencies)-1]),
+	}
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,131 @@
+package loadgen
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Latency submit round trips in milliseconds
+type Latency struct {
+	Mean float64 `json:"mean_ms"`
+	P50  float64 `json:"p50_ms"`
+	P90  float64 `json:"p90_ms"`
+	P99  float64 `json:"p99_ms"`
+	Max  float64 `json:"max_ms"`
+}
+
+type Report struct {
+	Clients    int     `json:"clients"`
+	Connected  int     `json:"connected"`
+	Authorized int     `json:"authorized"`
+	GotJob     int     `json:"got_job"`
+	Seconds    float64 `json:"seconds"`
+
+	Submitted  int64            `json:"submitted"`
+	Sent       map[string]int64 `json:"sent"` // by share kind: valid, invalid, duplicate
+	Accepted   int64            `json:"accepted"`
+	Rejected   int64            `json:"rejected"`
+	Rejections map[string]int64 `json:"rejections"` // by server reason
+	Errors     int64            `json:"errors"`     // connections lost mid run
+
+	Throughput float64      `json:"throughput"`          // submitted shares per second
+	AcceptRate float64      `json:"accepted_per_second"` // accepted shares per second
+	Latency    Latency      `json:"latency"`
+	Server     *ServerUsage `json:"server,omitempty"`
+}
+
+func newReport(cfg Config, elapsed time.Duration) *Report {
+	return &Report{
+		Clients:    cfg.Clients,
+		Seconds:    elapsed.Seconds(),
+		Sent:       make(map[string]int64),
+		Rejections: make(map[string]int64),
+	}
+}
+
+func (r *Report) add(stats *workerStats) {
+	if stats.connected {
+		r.Connected++
+	}
+	if stats.authorized {
+		r.Authorized++
+	}
+	if stats.gotJob {
+		r.GotJob++
+	}
+	for kind, n := range stats.sent {
+		r.Sent[kind] += n
+		r.Submitted += n
+	}
+	r.Accepted += stats.accepted
+	for reason, n := range stats.rejections {
+		r.Rejections[reason] += n
+		r.Rejected += n
+	}
+	r.Errors += stats.errors
+	if r.Seconds > 0 {
+		r.Throughput = float64(r.Submitted) / r.Seconds
+		r.AcceptRate = float64(r.Accepted) / r.Seconds
+	}
+}
+
+func (r *Report) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+// WriteCSV one header and one value row, per kind and per reason counts as sent:<kind> and rejected:<reason> columns
+func (r *Report) WriteCSV(w io.Writer) error {
+	header := []string{"clients", "connected", "authorized", "got_job", "seconds", "submitted", "accepted", "rejected",
+		"errors", "throughput", "accepted_per_second", "mean_ms", "p50_ms", "p90_ms", "p99_ms", "max_ms"}
+	row := []string{itoa(r.Clients), itoa(r.Connected), itoa(r.Authorized), itoa(r.GotJob), ftoa(r.Seconds),
+		i64toa(r.Submitted), i64toa(r.Accepted), i64toa(r.Rejected), i64toa(r.Errors), ftoa(r.Throughput), ftoa(r.AcceptRate),
+		ftoa(r.Latency.Mean), ftoa(r.Latency.P50), ftoa(r.Latency.P90), ftoa(r.Latency.P99), ftoa(r.Latency.Max)}
+	for _, kind := range sortedKeys(r.Sent) {
+		header, row = append(header, "sent:"+kind), append(row, i64toa(r.Sent[kind]))
+	}
+	for _, reason := range sortedKeys(r.Rejections) {
+		header, row = append(header, "rejected:"+reason), append(row, i64toa(r.Rejections[reason]))
+	}
+	if s := r.Server; s != nil {
+		header = append(header, "server_cpu_seconds", "server_cpu_cores", "server_peak_rss_bytes", "server_peak_goroutines",
+			"server_peak_connections")
+		row = append(row, ftoa(s.CPUSeconds), ftoa(s.CPUCores), ftoa(s.PeakRSSBytes), ftoa(s.PeakGoroutines),
+			ftoa(s.PeakConnections))
+	}
+	cw := csv.NewWriter(w)
+	_ = cw.Write(header)
+	_ = cw.Write(row)
+	cw.Flush()
+	return cw.Error()
+}
+
+// Write the report in format json or csv
+func (r *Report) Write(w io.Writer, format string) error {
+	switch format {
+	case "json":
+		return r.WriteJSON(w)
+	case "csv":
+		return r.WriteCSV(w)
+	}
+	return fmt.Errorf("unknown format: %s", format)
+}
+
+func sortedKeys(m map[string]int64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func itoa(n int) string     { return strconv.Itoa(n) }
+func i64toa(n int64) string { return strconv.FormatInt(n, 10) }
+func ftoa(f float64) string { return strconv.FormatFloat(f, 'f', -1, 64) }
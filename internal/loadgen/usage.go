@@ -0,0 +1,110 @@
+package loadgen
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ServerUsage server process resources over the run, from its prometheus metrics
+type ServerUsage struct {
+	CPUSeconds      float64 `json:"cpu_seconds"`
+	CPUCores        float64 `json:"cpu_cores"` // average cores busy
+	PeakRSSBytes    float64 `json:"peak_rss_bytes"`
+	PeakGoroutines  float64 `json:"peak_goroutines"`
+	PeakConnections float64 `json:"peak_connections"`
+}
+
+// ParseMetrics unlabeled samples of a prometheus text exposition
+func ParseMetrics(r io.Reader) (map[string]float64, error) {
+	samples := make(map[string]float64)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.Contains(line, "{") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		value, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			continue
+		}
+		samples[fields[0]] = value
+	}
+	return samples, scanner.Err()
+}
+
+type usageSampler struct {
+	url   string
+	first map[string]float64
+	last  map[string]float64
+	peak  map[string]float64
+	mu    sync.Mutex
+}
+
+func newUsageSampler(url string) *usageSampler {
+	return &usageSampler{url: url, peak: make(map[string]float64)}
+}
+
+func (u *usageSampler) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_ = u.sample()
+		}
+	}
+}
+
+func (u *usageSampler) sample() error {
+	resp, err := http.Get(u.url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", u.url, resp.Status)
+	}
+	samples, err := ParseMetrics(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.first == nil {
+		u.first = samples
+	}
+	u.last = samples
+	for name, value := range samples {
+		if value > u.peak[name] {
+			u.peak[name] = value
+		}
+	}
+	return nil
+}
+
+func (u *usageSampler) usage(elapsed time.Duration) *ServerUsage {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	cpu := u.last["process_cpu_seconds_total"] - u.first["process_cpu_seconds_total"]
+	return &ServerUsage{
+		CPUSeconds:      cpu,
+		CPUCores:        cpu / elapsed.Seconds(),
+		PeakRSSBytes:    u.peak["process_resident_memory_bytes"],
+		PeakGoroutines:  u.peak["go_goroutines"],
+		PeakConnections: u.peak["tcpmsg_server_connections_active"],
+	}
+}
@@ -0,0 +1,132 @@
+// Package protocol typed params of the wire protocol, decoded and validated the same way by server and client
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+const (
+	MaxUsernameLength = 64
+	MaxNonceLength    = 64
+	ResultLength      = 64 // hex encoded sha256
+)
+
+// ErrMissingParams params absent or null, the message is sent to the peer as is
+var ErrMissingParams = errors.New("Missing required parameters")
+
+// InvalidParamsError a param of the wrong type or failing validation
+type InvalidParamsError struct {
+	Field  string
+	Reason string
+}
+
+func (e *InvalidParamsError) Error() string {
+	return fmt.Sprintf("Invalid parameters: %s %s", e.Field, e.Reason)
+}
+
+type Params interface {
+	Validate() error
+}
+
+type AuthorizeParams struct {
+	Username string `json:"username"`
+}
+
+func (p *AuthorizeParams) Validate() error {
+	return checkToken("username", p.Username, MaxUsernameLength, nil)
+}
+
+type SubmitParams struct {
+	JobID       int    `json:"job_id"`
+	ClientNonce string `json:"client_nonce"`
+	Result      string `json:"result"`
+}
+
+func (p *SubmitParams) Validate() error {
+	if p.JobID <= 0 {
+		return &InvalidParamsError{Field: "job_id", Reason: "must be a positive integer"}
+	}
+	if err := checkToken("client_nonce", p.ClientNonce, MaxNonceLength, isAlphanumeric); err != nil {
+		return err
+	}
+	if len(p.Result) != ResultLength {
+		return &InvalidParamsError{Field: "result", Reason: fmt.Sprintf("must be %d hex digits", ResultLength)}
+	}
+	for i := 0; i < len(p.Result); i++ {
+		if c := p.Result[i]; !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return &InvalidParamsError{Field: "result", Reason: "must be lowercase hex"}
+		}
+	}
+	return nil
+}
+
+type JobParams struct {
+	JobID       int    `json:"job_id"`
+	ServerNonce string `json:"server_nonce"` // same for every session on the job
+	Extranonce  string `json:"extranonce,omitempty"`
+	CleanJobs   bool   `json:"clean_jobs"` // earlier jobs are no longer accepted
+}
+
+func (p *JobParams) Validate() error {
+	if p.JobID <= 0 {
+		return &InvalidParamsError{Field: "job_id", Reason: "must be a positive integer"}
+	}
+	if err := checkToken("server_nonce", p.ServerNonce, MaxNonceLength, isAlphanumeric); err != nil {
+		return err
+	}
+	if p.Extranonce == "" {
+		return nil
+	}
+	return checkToken("extranonce", p.Extranonce, MaxNonceLength, isAlphanumeric)
+}
+
+// Result expected result of a share of the job found with clientNonce
+func (p *JobParams) Result(clientNonce string) string {
+	return Result(p.ServerNonce, p.Extranonce, clientNonce)
+}
+
+// Decode strictly decode raw into params and validate them: numbers must be integers of the field type,
+// strings must be strings, missing fields fail validation
+func Decode(raw json.RawMessage, params Params) error {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return ErrMissingParams
+	}
+	if err := json.Unmarshal(raw, params); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) && typeErr.Field != "" {
+			return &InvalidParamsError{Field: typeErr.Field, Reason: "has the wrong type"}
+		}
+		return &InvalidParamsError{Field: "params", Reason: "must be an object"}
+	}
+	return params.Validate()
+}
+
+// Encode params for a message, they are plain structs so marshaling cannot fail
+func Encode(params Params) json.RawMessage {
+	data, _ := json.Marshal(params)
+	return data
+}
+
+// checkToken value is required, at most maxLength bytes, and made of valid characters unless valid is nil
+func checkToken(field, value string, maxLength int, valid func(c byte) bool) error {
+	if value == "" {
+		return &InvalidParamsError{Field: field, Reason: "is required"}
+	}
+	if len(value) > maxLength {
+		return &InvalidParamsError{Field: field, Reason: fmt.Sprintf("exceeds %d characters", maxLength)}
+	}
+	for i := 0; valid != nil && i < len(value); i++ {
+		if !valid(value[i]) {
+			return &InvalidParamsError{Field: field, Reason: "has invalid characters"}
+		}
+	}
+	return nil
+}
+
+func isAlphanumeric(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
@@ -0,0 +1,22 @@
+package protocol
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// Result expected result of a submit: hex encoded SHA256(server_nonce + extranonce + client_nonce), the extranonce of
+// the session keeps its work distinct from other sessions on the same job
+func Result(serverNonce, extranonce, clientNonce string) string {
+	hash := sha256.Sum256([]byte(serverNonce + extranonce + clientNonce))
+	return hex.EncodeToString(hash[:])
+}
+
+// CorruptResult a result that never matches the one given: its first hex digit changed
+func CorruptResult(result string) string {
+	if strings.HasPrefix(result, "0") {
+		return "1" + result[1:]
+	}
+	return "0" + result[1:]
+}
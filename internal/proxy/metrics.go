@@ -0,0 +1,21 @@
+package proxy
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	sharesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "tcpmsg_proxy_shares_total",
+		Help: "Valid downstream shares by outcome: skipped, stale, queued, dropped from the queue as stale, upstream_accepted, upstream_rejected.",
+	}, []string{"outcome"})
+	upstreamJobsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "tcpmsg_proxy_upstream_jobs_total",
+		Help: "Jobs received from the upstream pool.",
+	})
+	upstreamConnected = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "tcpmsg_proxy_upstream_connected",
+		Help: "1 while the upstream session is authorized.",
+	})
+)
@@ -0,0 +1,401 @@
+// Package proxy aggregate the sessions of a server.Server into one upstream pool session: upstream jobs are re-issued
+// downstream within the upstream extranonce, downstream shares are validated locally and qualifying ones forwarded
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"luxor.tech/tcp_msg_processing_test/internal/client"
+	"luxor.tech/tcp_msg_processing_test/internal/protocol"
+	"luxor.tech/tcp_msg_processing_test/internal/server"
+	"luxor.tech/tcp_msg_processing_test/pkg/clock"
+	"luxor.tech/tcp_msg_processing_test/pkg/logger"
+	"luxor.tech/tcp_msg_processing_test/pkg/util"
+)
+
+// maxJobs upstream jobs shares are still forwarded to, the history the upstream accepts shares of
+const maxJobs = 100
+
+// ErrNoUpstreamJob no job received from the upstream yet, downstream sessions wait for the first one
+var ErrNoUpstreamJob = errors.New("no upstream job yet")
+
+type Config struct {
+	Upstream        string        // upstream pool address
+	Username        string        // authorized upstream, forwarded shares are credited to it
+	ForwardZeros    int           // leading zero hex digits a share result needs to be forwarded, 0 forwards any
+	ForwardInterval time.Duration // shortest time between forwarded shares, the upstream rate limit
+	ReconnectDelay  time.Duration // wait before reconnecting a lost upstream
+	QueueSize       int           // shares waiting to be sent upstream, further qualifying ones are skipped
+}
+
+func DefaultConfig() Config {
+	return Config{
+		ForwardInterval: time.Second,
+		ReconnectDelay:  time.Second * 5,
+		QueueSize:       64,
+	}
+}
+
+func (cfg Config) Validate() error {
+	switch {
+	case cfg.Upstream == "":
+		return fmt.Errorf("upstream address required")
+	case cfg.Username == "":
+		return fmt.Errorf("upstream username required")
+	case cfg.ForwardZeros < 0 || cfg.ForwardZeros > protocol.ResultLength:
+		return fmt.Errorf("forward zeros must be within 0-%d", protocol.ResultLength)
+	}
+	return nil
+}
+
+// UserStats shares of one downstream username
+type UserStats struct {
+	Username         string    `json:"username"`
+	Accepted         int64     `json:"accepted"`  // valid shares
+	Rejected         int64     `json:"rejected"`  // invalid shares, counted once the server flushes its rejections
+	Forwarded        int64     `json:"forwarded"` // accepted shares sent upstream
+	UpstreamAccepted int64     `json:"upstream_accepted"`
+	UpstreamRejected int64     `json:"upstream_rejected"`
+	LastShare        time.Time `json:"last_share"`
+}
+
+// upstreamJob job of the upstream session a local job carries on
+type upstreamJob struct {
+	ID         int
+	Extranonce string
+}
+
+// forward share to send upstream
+type forward struct {
+	username    string
+	serverNonce string // of the upstream job, the share is dropped once the job is no longer known
+	jobID       int
+	clientNonce string
+	result      string
+}
+
+// Proxy JobSource of the upstream jobs, ShareHandler forwarding downstream shares, and Store of per-username
+// statistics for the server of the downstream sessions
+type Proxy struct {
+	cfg     Config
+	changes chan struct{}
+	clock   clock.Clock
+
+	mu        sync.Mutex
+	current   server.Job             // latest upstream job, empty server nonce without an upstream session job
+	cleanJobs int                    // upstream clean jobs so far, the tip of local jobs
+	jobs      map[string]upstreamJob // latest upstream job by server nonce
+	jobOrder  []string               // server nonces of jobs, oldest first
+	users     map[string]*UserStats
+	pending   map[int]string // username of forwarded shares by request id
+	queue     chan forward   // shares to send on the upstream session, nil while disconnected
+}
+
+func NewProxy(cfg Config) *Proxy {
+	return &Proxy{
+		cfg:     cfg,
+		changes: make(chan struct{}, 1),
+		clock:   clock.Real,
+		jobs:    make(map[string]upstreamJob),
+		users:   make(map[string]*UserStats),
+		pending: make(map[int]string),
+	}
+}
+
+// SetClock replace the wall clock pacing forwarded shares, call before Run
+func (p *Proxy) SetClock(clk clock.Clock) {
+	p.clock = clk
+}
+
+// NextJob the latest job of the upstream session, downstream extranonces are split off its extranonce
+func (p *Proxy) NextJob() (server.Job, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.current.ServerNonce == "" {
+		return server.Job{}, ErrNoUpstreamJob
+	}
+	return p.current, nil
+}
+
+func (p *Proxy) JobChanges() <-chan struct{} {
+	return p.changes
+}
+
+// HandleShare count a valid downstream share and queue it upstream when it qualifies: its result has ForwardZeros
+// leading zeros and its job is one of the current upstream session
+func (p *Proxy) HandleShare(share server.Share) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	user := p.user(share.Username)
+	user.Accepted++
+	user.LastShare = share.Time
+
+	outcome := "skipped"
+	defer func() {
+		sharesTotal.WithLabelValues(outcome).Inc()
+	}()
+	if !strings.HasPrefix(share.Result, strings.Repeat("0", p.cfg.ForwardZeros)) {
+		return
+	}
+	job, ok := p.jobs[share.ServerNonce]
+	if !ok || !strings.HasPrefix(share.Extranonce, job.Extranonce) {
+		outcome = "stale"
+		return
+	}
+	// the upstream hashes its extranonce then the client nonce: the downstream share of the extranonce leads it
+	clientNonce := share.Extranonce[len(job.Extranonce):] + share.ClientNonce
+	if len(clientNonce) > protocol.MaxNonceLength {
+		return
+	}
+	select {
+	case p.queue <- forward{username: share.Username, serverNonce: share.ServerNonce, jobID: job.ID, clientNonce: clientNonce, result: share.Result}:
+		outcome = "queued"
+	default:
+	}
+}
+
+// UpsertSubmission accepted shares are counted by HandleShare
+func (p *Proxy) UpsertSubmission(context.Context, string, time.Time, int) error {
+	return nil
+}
+
+// ReplaySubmission nothing is spooled, the proxy keeps no database
+func (p *Proxy) ReplaySubmission(context.Context, string, string, time.Time, int) (bool, error) {
+	return true, nil
+}
+
+func (p *Proxy) UpsertRejection(_ context.Context, username string, _ time.Time, _ string, count int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.user(username).Rejected += int64(count)
+	return nil
+}
+
+// Users statistics of every downstream username, sorted by username
+func (p *Proxy) Users() []UserStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	users := make([]UserStats, 0, len(p.users))
+	for _, user := range p.users {
+		users = append(users, *user)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Username < users[j].Username })
+	return users
+}
+
+// Connected whether the upstream session is authorized
+func (p *Proxy) Connected() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.queue != nil
+}
+
+// Run keep an upstream session until ctx ends, reconnecting ReconnectDelay after it is lost
+func (p *Proxy) Run(ctx context.Context) {
+	for {
+		err := p.session(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		logger.Error("Upstream session lost:%v", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(p.cfg.ReconnectDelay):
+		}
+	}
+}
+
+// session connect and authorize upstream, then take its jobs and forward shares until it fails or ctx ends
+func (p *Proxy) session(ctx context.Context) error {
+	c := client.NewClient(p.cfg.Upstream, p.cfg.Username, 0, time.Minute)
+	if err := c.Connect(); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	defer func() {
+		cancel()
+		wg.Wait()
+		p.disconnected()
+	}()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		<-ctx.Done()
+		c.Close() // unblocks the read below
+	}()
+	if err := c.Authorize(); err != nil {
+		return err
+	}
+	queue := p.connected()
+	logger.Info("Upstream session authorized:%s@%s", p.cfg.Username, p.cfg.Upstream)
+
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		c.StartKeepalive(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		p.forward(ctx, c, queue)
+	}()
+
+	first := true
+	for {
+		req, resp, err := c.ReceiveMessage()
+		if err != nil {
+			return err
+		}
+		switch {
+		case resp != nil:
+			p.answered(resp)
+		case req.Method == "job":
+			job, err := req.Job()
+			if err != nil {
+				logger.Warn("Invalid upstream job:%v", err)
+				continue
+			}
+			p.setJob(job, first)
+			first = false
+		case req.Method == "ping":
+			if err := c.Pong(req.ID); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// forward send the shares of queue upstream ForwardInterval apart until ctx ends, their responses are matched by
+// answered. A share whose upstream job was dropped meanwhile is skipped
+func (p *Proxy) forward(ctx context.Context, c *client.Client, queue <-chan forward) {
+	var last time.Time
+	for {
+		var f forward
+		select {
+		case <-ctx.Done():
+			return
+		case f = <-queue:
+		}
+		if wait := p.cfg.ForwardInterval - p.clock.Since(last); !last.IsZero() && wait > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-p.clock.After(wait):
+			}
+		}
+		id := *util.GenerateID()
+		p.mu.Lock()
+		if _, ok := p.jobs[f.serverNonce]; !ok {
+			p.mu.Unlock()
+			sharesTotal.WithLabelValues("dropped").Inc()
+			continue
+		}
+		p.pending[id] = f.username
+		p.mu.Unlock()
+		if err := c.SendSubmit(id, f.jobID, f.clientNonce, f.result); err != nil {
+			logger.Error("Failed to forward share upstream:%v", err)
+			p.mu.Lock()
+			delete(p.pending, id)
+			p.mu.Unlock()
+			continue
+		}
+		last = p.clock.Now()
+		p.mu.Lock()
+		p.user(f.username).Forwarded++
+		p.mu.Unlock()
+		logger.Debugw("Share forwarded", "username", f.username, "job_id", f.jobID)
+	}
+}
+
+// answered count the upstream response to a forwarded share
+func (p *Proxy) answered(resp *client.Response) {
+	if resp.ID == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	username, ok := p.pending[*resp.ID]
+	if !ok {
+		return
+	}
+	delete(p.pending, *resp.ID)
+	user := p.user(username)
+	if resp.Result {
+		user.UpstreamAccepted++
+		sharesTotal.WithLabelValues("upstream_accepted").Inc()
+		return
+	}
+	user.UpstreamRejected++
+	sharesTotal.WithLabelValues("upstream_rejected").Inc()
+	logger.Warnw("Upstream rejected share", "username", username, "error", resp.Error)
+}
+
+// setJob make an upstream job the next local one, the first job of a session is clean as the extranonce changed
+func (p *Proxy) setJob(job client.Task, first bool) {
+	p.mu.Lock()
+	if job.CleanJobs || first {
+		p.cleanJobs++
+		p.jobs, p.jobOrder = make(map[string]upstreamJob), nil
+	}
+	if _, known := p.jobs[job.ServerNonce]; !known {
+		p.jobOrder = append(p.jobOrder, job.ServerNonce)
+	}
+	p.jobs[job.ServerNonce] = upstreamJob{ID: job.JobID, Extranonce: job.Extranonce}
+	if len(p.jobOrder) > maxJobs {
+		delete(p.jobs, p.jobOrder[0])
+		p.jobOrder = p.jobOrder[1:]
+	}
+	p.current = server.Job{
+		ServerNonce: job.ServerNonce,
+		Tip:         strconv.Itoa(p.cleanJobs),
+		Extranonce:  job.Extranonce,
+	}
+	p.mu.Unlock()
+	upstreamJobsTotal.Inc()
+	logger.Debugw("Upstream job", "job_id", job.JobID, "clean_jobs", job.CleanJobs)
+
+	select {
+	case p.changes <- struct{}{}:
+	default:
+	}
+}
+
+// connected start taking shares for a just authorized upstream session, returns their queue
+func (p *Proxy) connected() <-chan forward {
+	queue := make(chan forward, max(p.cfg.QueueSize, 1))
+	p.mu.Lock()
+	p.queue = queue
+	p.mu.Unlock()
+	upstreamConnected.Set(1)
+	return queue
+}
+
+// disconnected drop what belonged to the lost upstream session: its jobs, queued shares and unanswered ones. The
+// next session gets another extranonce, so none of it is valid there
+func (p *Proxy) disconnected() {
+	p.mu.Lock()
+	p.queue = nil
+	p.current = server.Job{}
+	p.jobs, p.jobOrder = make(map[string]upstreamJob), nil
+	p.pending = make(map[int]string)
+	p.mu.Unlock()
+	upstreamConnected.Set(0)
+}
+
+// user statistics of username, p.mu must be held
+func (p *Proxy) user(username string) *UserStats {
+	user, ok := p.users[username]
+	if !ok {
+		user = &UserStats{Username: username}
+		p.users[username] = user
+	}
+	return user
+}
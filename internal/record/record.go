@@ -0,0 +1,152 @@
+// Package record traffic recordings of a connection: every frame with its time and direction, one JSON object per
+// line, so a session a miner complains about can be verified offline or replayed against a server
+package record
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+type Direction string
+
+const (
+	In  Direction = "in"  // client to server
+	Out Direction = "out" // server to client
+)
+
+// Header first line of a recording
+type Header struct {
+	SessionID  uint64    `json:"session_id"`
+	Username   string    `json:"username"`
+	RemoteAddr string    `json:"remote_addr"`
+	Started    time.Time `json:"started"`
+}
+
+type Frame struct {
+	Time time.Time `json:"time"`
+	Dir  Direction `json:"dir"`
+	Data string    `json:"data"` // one protocol message without its newline
+}
+
+type Recording struct {
+	Header Header
+	Frames []Frame
+}
+
+// Writer append frames of one connection to its recording file
+type Writer struct {
+	path string
+
+	file    *os.File
+	buf     *bufio.Writer
+	pending map[Direction][]byte // partial line written so far
+	mu      sync.Mutex
+}
+
+// Create a recording in dir named after the username, session and start time
+func Create(dir string, header Header) (*Writer, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	name := fmt.Sprintf("%s-%d-%s.jsonl", header.Username, header.SessionID, header.Started.UTC().Format("20060102T150405.000000000"))
+	path := filepath.Join(dir, name)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	w := &Writer{path: path, file: file, buf: bufio.NewWriter(file), pending: make(map[Direction][]byte)}
+	if err := w.writeLine(header); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *Writer) Path() string {
+	return w.path
+}
+
+// Write record the bytes sent in one direction at time at, a frame per complete line
+func (w *Writer) Write(at time.Time, dir Direction, data []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return os.ErrClosed
+	}
+	data = append(w.pending[dir], data...)
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		if line := bytes.TrimSpace(data[:i]); len(line) > 0 {
+			if err := w.writeLine(Frame{Time: at, Dir: dir, Data: string(line)}); err != nil {
+				return err
+			}
+		}
+		data = data[i+1:]
+	}
+	w.pending[dir] = append([]byte(nil), data...)
+	// flushed per write, the recording is read while the connection may still be open
+	return w.buf.Flush()
+}
+
+// Close the recording, an unterminated last line is dropped
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	err := w.buf.Flush()
+	if cerr := w.file.Close(); err == nil {
+		err = cerr
+	}
+	w.file = nil
+	return err
+}
+
+func (w *Writer) writeLine(v interface{}) error {
+	line, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.buf.Write(append(line, '\n'))
+	return err
+}
+
+// ReadFile load the recording at path
+func ReadFile(path string) (*Recording, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64<<10), 16<<20)
+	rec := &Recording{}
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%s: empty recording", path)
+	}
+	if err := json.Unmarshal(scanner.Bytes(), &rec.Header); err != nil {
+		return nil, fmt.Errorf("%s: invalid header: %v", path, err)
+	}
+	for line := 2; scanner.Scan(); line++ {
+		var frame Frame
+		if err := json.Unmarshal(scanner.Bytes(), &frame); err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid frame: %v", path, line, err)
+		}
+		rec.Frames = append(rec.Frames, frame)
+	}
+	return rec, scanner.Err()
+}
@@ -0,0 +1,201 @@
+package record
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"luxor.tech/tcp_msg_processing_test/internal/protocol"
+)
+
+type ReplayOptions struct {
+	// Speed scales the recorded gaps between inbound frames, 2 replays twice as fast, 0 sends back to back
+	Speed float64
+	// Rewrite points submits at the latest job of the live server and recomputes their result with the recorded
+	// client nonce, a recorded share not matching its recorded job gets a wrong result so it stays invalid;
+	// otherwise frames are sent verbatim and shares of recorded jobs are stale on a new server
+	Rewrite bool
+	// Wait bounds the wait for a live job before a rewritten submit, and for responses after the last frame
+	Wait time.Duration
+}
+
+func DefaultReplayOptions() ReplayOptions {
+	return ReplayOptions{Speed: 1, Wait: 5 * time.Second}
+}
+
+// Replay send the inbound frames of rec over conn with their recorded pacing and record the live traffic, Verify on
+// the result gives the live answers to compare with the recorded ones. The connection is not closed
+func Replay(ctx context.Context, conn net.Conn, rec *Recording, opts ReplayOptions) (*Recording, error) {
+	r := &replayer{
+		live:     &Recording{Header: Header{Username: rec.Header.Username, RemoteAddr: conn.RemoteAddr().String(), Started: time.Now()}},
+		lines:    make(chan string, 64),
+		recorded: make(map[int]protocol.JobParams),
+	}
+	go func() {
+		defer close(r.lines)
+		reader := bufio.NewReader(conn)
+		for {
+			line, err := reader.ReadString('\n')
+			if line = strings.TrimSpace(line); line != "" {
+				r.lines <- line
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	// unblock the reader once done, the caller owns conn
+	defer func() {
+		_ = conn.SetReadDeadline(time.Now())
+		for range r.lines {
+		}
+		_ = conn.SetReadDeadline(time.Time{})
+	}()
+
+	var prev time.Time
+	for _, frame := range rec.Frames {
+		if frame.Dir != In {
+			r.record(frame.Data)
+			continue
+		}
+		var gap time.Duration
+		if !prev.IsZero() && opts.Speed > 0 {
+			gap = time.Duration(float64(frame.Time.Sub(prev)) / opts.Speed)
+		}
+		prev = frame.Time
+		if err := r.pump(ctx, gap, nil); err != nil {
+			return r.live, r.done(err)
+		}
+
+		data := frame.Data
+		if opts.Rewrite {
+			var err error
+			if data, err = r.rewrite(ctx, data, opts.Wait); err != nil {
+				return r.live, r.done(err)
+			}
+		}
+		if _, err := conn.Write([]byte(data + "\n")); err != nil {
+			return r.live, err
+		}
+		r.live.Frames = append(r.live.Frames, Frame{Time: time.Now(), Dir: In, Data: data})
+		if expectsResponse(data) {
+			r.sent++
+		}
+	}
+	err := r.pump(ctx, opts.Wait, func() bool { return r.answered >= r.sent })
+	return r.live, r.done(err)
+}
+
+var errConnClosed = errors.New("connection closed by server")
+
+type replayer struct {
+	live  *Recording
+	lines chan string
+
+	job            *protocol.JobParams        // latest live job
+	recorded       map[int]protocol.JobParams // recorded jobs by job_id, the ones recorded shares are checked against
+	sent, answered int                        // requests the server answers, responses received
+}
+
+// expectsResponse the server answers data with a result, unparsable lines included
+func expectsResponse(data string) bool {
+	var msg message
+	if json.Unmarshal([]byte(data), &msg) != nil {
+		return true
+	}
+	return msg.Method == "authorize" || msg.Method == "submit"
+}
+
+// pump record server frames during d or until cond holds
+func (r *replayer) pump(ctx context.Context, d time.Duration, cond func() bool) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	for cond == nil || !cond() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+			return nil
+		case line, ok := <-r.lines:
+			if !ok {
+				return errConnClosed
+			}
+			r.receive(line)
+		}
+	}
+	return nil
+}
+
+// record a job pushed in the recording
+func (r *replayer) record(line string) {
+	var msg message
+	if json.Unmarshal([]byte(line), &msg) != nil || msg.Method != "job" {
+		return
+	}
+	var job protocol.JobParams
+	if protocol.Decode(msg.Params, &job) == nil {
+		r.recorded[job.JobID] = job
+	}
+}
+
+func (r *replayer) receive(line string) {
+	r.live.Frames = append(r.live.Frames, Frame{Time: time.Now(), Dir: Out, Data: line})
+	var msg message
+	if json.Unmarshal([]byte(line), &msg) != nil {
+		return
+	}
+	switch msg.Method {
+	case "job":
+		var job protocol.JobParams
+		if protocol.Decode(msg.Params, &job) == nil {
+			r.job = &job
+		}
+	case "":
+		r.answered++
+	}
+}
+
+// rewrite a submit frame for the live job, other frames are returned as is
+func (r *replayer) rewrite(ctx context.Context, data string, wait time.Duration) (string, error) {
+	var msg message
+	if json.Unmarshal([]byte(data), &msg) != nil || msg.Method != "submit" {
+		return data, nil
+	}
+	var params protocol.SubmitParams
+	if protocol.Decode(msg.Params, &params) != nil {
+		return data, nil // malformed params are replayed verbatim
+	}
+	if r.job == nil {
+		if err := r.pump(ctx, wait, func() bool { return r.job != nil }); err != nil {
+			return "", err
+		}
+		if r.job == nil {
+			return "", errors.New("no job received from the server")
+		}
+	}
+	recorded, ok := r.recorded[params.JobID]
+	valid := ok && recorded.Result(params.ClientNonce) == params.Result
+	params.JobID, params.Result = r.job.JobID, r.job.Result(params.ClientNonce)
+	if !valid {
+		params.Result = protocol.CorruptResult(params.Result)
+	}
+	out, _ := json.Marshal(struct {
+		ID     *int            `json:"id,omitempty"`
+		Method string          `json:"method"`
+		Params json.RawMessage `json:"params"`
+	}{msg.ID, msg.Method, protocol.Encode(&params)})
+	return string(out), nil
+}
+
+// done map the end of the server stream, expected once it closed the connection, to a clean stop
+func (r *replayer) done(err error) error {
+	if errors.Is(err, errConnClosed) || errors.Is(err, io.EOF) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,113 @@
+package record
+
+import (
+	"encoding/json"
+	"time"
+
+	"luxor.tech/tcp_msg_processing_test/internal/protocol"
+)
+
+// message union of the requests and responses of the wire protocol
+type message struct {
+	ID     *int            `json:"id,omitempty"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result bool            `json:"result"`
+	Error  string          `json:"error"`
+}
+
+// Check a recorded submit, its result recomputed from the job it names and the server answer
+type Check struct {
+	Time        time.Time `json:"time"`
+	RequestID   *int      `json:"request_id"`
+	JobID       int       `json:"job_id"`
+	ServerNonce string    `json:"server_nonce"` // empty when no job with JobID was recorded
+	Extranonce  string    `json:"extranonce"`
+	ClientNonce string    `json:"client_nonce"`
+	Result      string    `json:"result"`
+	Expected    string    `json:"expected"` // protocol.Result of the nonces
+	ParamsError string    `json:"params_error,omitempty"`
+
+	Answered bool   `json:"answered"`
+	Accepted bool   `json:"accepted"`
+	Error    string `json:"error"` // server answer when rejected
+}
+
+// Valid the submitted result matches the recorded job
+func (c Check) Valid() bool {
+	return c.ParamsError == "" && c.Expected != "" && c.Expected == c.Result
+}
+
+// Suspect the server answer contradicts the recomputed result: a valid share rejected as invalid, or an invalid one
+// accepted. Other rejections (stale job, duplicate, rate limit) depend on session state and are not suspect
+func (c Check) Suspect() bool {
+	if !c.Answered {
+		return false
+	}
+	if c.Accepted {
+		return !c.Valid()
+	}
+	return c.Valid() && c.Error == "Invalid result"
+}
+
+// Verify replay the frames offline: jobs pushed by the server give the nonces of every job_id, each submit is checked
+// against it and paired with the server response of the same id (the oldest unanswered one when ids are absent)
+func Verify(rec *Recording) []Check {
+	jobs := make(map[int]protocol.JobParams)
+	var checks []Check
+	type request struct {
+		id    *int
+		check int // index in checks, -1 for other methods
+	}
+	var pending []request // unanswered requests in order
+	for _, frame := range rec.Frames {
+		var msg message
+		if err := json.Unmarshal([]byte(frame.Data), &msg); err != nil {
+			if frame.Dir == In { // answered "unknown request" without id
+				pending = append(pending, request{check: -1})
+			}
+			continue
+		}
+		switch {
+		case frame.Dir == Out && msg.Method == "job":
+			var job protocol.JobParams
+			if protocol.Decode(msg.Params, &job) == nil {
+				jobs[job.JobID] = job
+			}
+		case frame.Dir == In && msg.Method == "submit":
+			check := Check{Time: frame.Time, RequestID: msg.ID}
+			var params protocol.SubmitParams
+			if err := protocol.Decode(msg.Params, &params); err != nil {
+				check.ParamsError = err.Error()
+			}
+			// partially decoded params are still worth showing
+			check.JobID, check.ClientNonce, check.Result = params.JobID, params.ClientNonce, params.Result
+			if job, ok := jobs[params.JobID]; ok {
+				check.ServerNonce, check.Extranonce = job.ServerNonce, job.Extranonce
+				check.Expected = job.Result(params.ClientNonce)
+			}
+			pending = append(pending, request{id: msg.ID, check: len(checks)})
+			checks = append(checks, check)
+		case frame.Dir == In && msg.Method == "authorize":
+			pending = append(pending, request{id: msg.ID, check: -1})
+		case frame.Dir == Out && msg.Method == "":
+			for i, req := range pending {
+				if sameID(req.id, msg.ID) {
+					if req.check >= 0 {
+						checks[req.check].Answered, checks[req.check].Accepted, checks[req.check].Error = true, msg.Result, msg.Error
+					}
+					pending = append(pending[:i], pending[i+1:]...)
+					break
+				}
+			}
+		}
+	}
+	return checks
+}
+
+func sameID(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
@@ -0,0 +1,258 @@
+package rollup
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"luxor.tech/tcp_msg_processing_test/pkg/logger"
+)
+
+const (
+	day = time.Hour * 24
+
+	// rollupLockID pg advisory lock key, one roller at a time across servers
+	rollupLockID = 7_340_113
+)
+
+type Config struct {
+	Interval           time.Duration // run period of the background job
+	Lookback           time.Duration // rolled up windows recomputed each run, absorbs late shares
+	MinuteRetention    time.Duration // minute rows kept, 0 keeps all
+	HourlyRetention    time.Duration // hourly rows kept, 0 keeps all
+	ReplayRetention    time.Duration // spool_replays ids kept, longer than a spooled share can wait, 0 keeps all
+	RejectionRetention time.Duration // rejected_submissions counters kept, they are not rolled up, 0 keeps all
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Interval:           time.Minute * 5,
+		Lookback:           time.Hour * 2,
+		MinuteRetention:    day * 7,
+		HourlyRetention:    day * 90,
+		ReplayRetention:    day * 7,
+		RejectionRetention: day * 30,
+	}
+}
+
+// State progress of one rollup level as stored in rollup_state
+type State struct {
+	LastWindow   time.Time // zero when never rolled up
+	PrunedBefore time.Time // zero when the source was never pruned
+}
+
+// Plan the work of one run, empty ranges mean nothing to do
+type Plan struct {
+	HourlyFrom, HourlyTo time.Time // minute rows rolled into hours
+	DailyFrom, DailyTo   time.Time // hourly rows rolled into days
+	MinuteCutoff         time.Time // minute rows before are deleted, zero keeps all
+	HourlyCutoff         time.Time // hourly rows before are deleted, zero keeps all
+}
+
+// MakePlan windows to roll up and prune at now. Only complete windows are rolled up, recomputation
+// never reaches pruned source rows, and source rows are pruned only once rolled up.
+// earliestMinute is the oldest minute row, used before the first run.
+func MakePlan(now time.Time, hourly, daily State, earliestMinute time.Time, cfg Config) Plan {
+	now = now.UTC()
+	var plan Plan
+
+	plan.HourlyTo = now.Truncate(time.Hour)
+	plan.HourlyFrom = earliestMinute.Truncate(time.Hour)
+	if !hourly.LastWindow.IsZero() {
+		plan.HourlyFrom = hourly.LastWindow.Add(-cfg.Lookback).Truncate(time.Hour)
+	}
+	if plan.HourlyFrom.IsZero() || plan.HourlyFrom.Before(hourly.PrunedBefore) {
+		plan.HourlyFrom = hourly.PrunedBefore
+	}
+	hourlyDone := maxTime(hourly.LastWindow, plan.HourlyTo)
+	if plan.HourlyFrom.IsZero() {
+		plan.HourlyFrom = plan.HourlyTo // no minute rows yet
+	}
+
+	plan.DailyTo = minTime(now.Truncate(day), hourlyDone.Truncate(day))
+	plan.DailyFrom = plan.HourlyFrom.Truncate(day)
+	if !daily.LastWindow.IsZero() {
+		plan.DailyFrom = minTime(plan.DailyFrom, daily.LastWindow.Add(-cfg.Lookback).Truncate(day))
+	}
+	plan.DailyFrom = maxTime(plan.DailyFrom, daily.PrunedBefore)
+	dailyDone := maxTime(daily.LastWindow, plan.DailyTo)
+
+	if cfg.MinuteRetention > 0 {
+		plan.MinuteCutoff = minTime(now.Add(-cfg.MinuteRetention), hourlyDone).Truncate(time.Hour)
+		plan.MinuteCutoff = maxTime(plan.MinuteCutoff, hourly.PrunedBefore)
+	}
+	if cfg.HourlyRetention > 0 {
+		plan.HourlyCutoff = minTime(now.Add(-cfg.HourlyRetention), dailyDone).Truncate(day)
+		plan.HourlyCutoff = maxTime(plan.HourlyCutoff, daily.PrunedBefore)
+	}
+	return plan
+}
+
+// Roller aggregate minute submissions into hourly and daily tables and prune old rows
+type Roller struct {
+	db  *sql.DB
+	cfg Config
+}
+
+func NewRoller(db *sql.DB, cfg Config) *Roller {
+	return &Roller{db: db, cfg: cfg}
+}
+
+// Start run periodically until ctx is done
+func (r *Roller) Start(ctx context.Context) {
+	if r.cfg.Interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(r.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		if _, err := r.Run(ctx, time.Now()); err != nil {
+			logger.Error("Rollup failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Run one idempotent rollup and retention pass in a single transaction,
+// skipped when another instance holds the rollup lock
+func (r *Roller) Run(ctx context.Context, now time.Time) (Plan, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Plan{}, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	var locked bool
+	if err := tx.QueryRowContext(ctx, `SELECT pg_try_advisory_xact_lock($1)`, rollupLockID).Scan(&locked); err != nil {
+		return Plan{}, err
+	}
+	if !locked {
+		logger.Debug("Rollup skipped, another instance is running it")
+		return Plan{}, nil
+	}
+
+	hourly, err := loadState(ctx, tx, "hourly")
+	if err != nil {
+		return Plan{}, err
+	}
+	daily, err := loadState(ctx, tx, "daily")
+	if err != nil {
+		return Plan{}, err
+	}
+	var earliest sql.NullTime
+	if hourly.LastWindow.IsZero() {
+		if err := tx.QueryRowContext(ctx, `SELECT MIN(timestamp) FROM submissions`).Scan(&earliest); err != nil {
+			return Plan{}, err
+		}
+	}
+	plan := MakePlan(now, hourly, daily, earliest.Time, r.cfg)
+
+	if plan.HourlyFrom.Before(plan.HourlyTo) {
+		if err := aggregate(ctx, tx, "submissions_hourly", "hour", "submissions", plan.HourlyFrom, plan.HourlyTo); err != nil {
+			return plan, err
+		}
+		hourly.LastWindow = maxTime(hourly.LastWindow, plan.HourlyTo)
+	}
+	if plan.DailyFrom.Before(plan.DailyTo) {
+		if err := aggregate(ctx, tx, "submissions_daily", "day", "submissions_hourly", plan.DailyFrom, plan.DailyTo); err != nil {
+			return plan, err
+		}
+		daily.LastWindow = maxTime(daily.LastWindow, plan.DailyTo)
+	}
+
+	if plan.MinuteCutoff.After(hourly.PrunedBefore) {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM submissions WHERE timestamp < $1`, plan.MinuteCutoff); err != nil {
+			return plan, err
+		}
+		hourly.PrunedBefore = plan.MinuteCutoff
+	}
+	if plan.HourlyCutoff.After(daily.PrunedBefore) {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM submissions_hourly WHERE timestamp < $1`, plan.HourlyCutoff); err != nil {
+			return plan, err
+		}
+		daily.PrunedBefore = plan.HourlyCutoff
+	}
+
+	if r.cfg.ReplayRetention > 0 {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM spool_replays WHERE replayed_at < $1`, now.UTC().Add(-r.cfg.ReplayRetention)); err != nil {
+			return plan, err
+		}
+	}
+	if r.cfg.RejectionRetention > 0 {
+		cutoff := now.UTC().Add(-r.cfg.RejectionRetention).Truncate(time.Minute)
+		if _, err := tx.ExecContext(ctx, `DELETE FROM rejected_submissions WHERE timestamp < $1`, cutoff); err != nil {
+			return plan, err
+		}
+	}
+
+	if err := saveState(ctx, tx, "hourly", hourly); err != nil {
+		return plan, err
+	}
+	if err := saveState(ctx, tx, "daily", daily); err != nil {
+		return plan, err
+	}
+	if err := tx.Commit(); err != nil {
+		return plan, err
+	}
+	logger.Debugw("Rollup done", "hourly_to", hourly.LastWindow, "daily_to", daily.LastWindow,
+		"minute_pruned_before", hourly.PrunedBefore, "hourly_pruned_before", daily.PrunedBefore)
+	return plan, nil
+}
+
+// aggregate replace the buckets of [from, to) in target with sums over source, re-runs are idempotent
+func aggregate(ctx context.Context, tx *sql.Tx, target, unit, source string, from, to time.Time) error {
+	query := fmt.Sprintf(`
+		INSERT INTO %s (username, timestamp, submission_count)
+		SELECT username, date_trunc('%s', timestamp), SUM(submission_count)
+		FROM %s
+		WHERE timestamp >= $1 AND timestamp < $2
+		GROUP BY 1, 2
+		ON CONFLICT (username, timestamp)
+		DO UPDATE SET submission_count = EXCLUDED.submission_count`, target, unit, source)
+	_, err := tx.ExecContext(ctx, query, from, to)
+	return err
+}
+
+func loadState(ctx context.Context, tx *sql.Tx, name string) (State, error) {
+	var lastWindow, prunedBefore sql.NullTime
+	err := tx.QueryRowContext(ctx, `SELECT last_window, pruned_before FROM rollup_state WHERE name = $1 FOR UPDATE`, name).
+		Scan(&lastWindow, &prunedBefore)
+	if err != nil && err != sql.ErrNoRows {
+		return State{}, err
+	}
+	return State{LastWindow: lastWindow.Time.UTC(), PrunedBefore: prunedBefore.Time.UTC()}, nil
+}
+
+func saveState(ctx context.Context, tx *sql.Tx, name string, state State) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO rollup_state (name, last_window, pruned_before)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (name) DO UPDATE SET last_window = EXCLUDED.last_window, pruned_before = EXCLUDED.pruned_before`,
+		name, nullTime(state.LastWindow), nullTime(state.PrunedBefore))
+	return err
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,159 @@
+package server
+
+import (
+	"net"
+
+	"luxor.tech/tcp_msg_processing_test/internal/protocol"
+	"luxor.tech/tcp_msg_processing_test/pkg/logger"
+)
+
+// Config current server settings
+func (s *Server) Config() Config {
+	return s.cfg
+}
+
+// Sessions snapshot of live sessions
+func (s *Server) Sessions() []SessionInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	infos := make([]SessionInfo, 0, len(s.sessions))
+	for conn, session := range s.sessions {
+		session.mu.Lock()
+		infos = append(infos, SessionInfo{
+			ID:          session.ID,
+			Username:    session.Username,
+			RemoteAddr:  conn.RemoteAddr().String(),
+			ConnectedAt: session.ConnectedAt,
+			CurrJobID:   session.CurrJobID,
+			Extranonce:  session.Extranonce,
+			LastSubmit:  session.LastSubmit,
+			Accepted:    session.Accepted,
+			Rejected:    session.Rejected,
+		})
+		session.mu.Unlock()
+	}
+	return infos
+}
+
+// Kick close the session with id, returns false when not found
+func (s *Server) Kick(id uint64) bool {
+	kicked := s.closeSessions(func(_ net.Conn, session *Session) bool {
+		return session.ID == id
+	})
+	return kicked > 0
+}
+
+// BanUsername refuse authorization of username and kick its live sessions
+func (s *Server) BanUsername(username string) int {
+	s.banMu.Lock()
+	s.bannedUsers[username] = true
+	s.banMu.Unlock()
+	return s.closeSessions(func(_ net.Conn, session *Session) bool {
+		return session.Username == username
+	})
+}
+
+// BanIP refuse connections from ip and kick its live sessions
+func (s *Server) BanIP(ip string) int {
+	s.banMu.Lock()
+	s.bannedIPs[ip] = true
+	s.banMu.Unlock()
+	return s.closeSessions(func(conn net.Conn, _ *Session) bool {
+		return remoteIP(conn) == ip
+	})
+}
+
+func (s *Server) UnbanUsername(username string) {
+	s.banMu.Lock()
+	delete(s.bannedUsers, username)
+	s.banMu.Unlock()
+}
+
+func (s *Server) UnbanIP(ip string) {
+	s.banMu.Lock()
+	delete(s.bannedIPs, ip)
+	s.banMu.Unlock()
+}
+
+// Bans banned usernames and ips
+func (s *Server) Bans() (usernames []string, ips []string) {
+	s.banMu.RLock()
+	defer s.banMu.RUnlock()
+	usernames, ips = make([]string, 0, len(s.bannedUsers)), make([]string, 0, len(s.bannedIPs))
+	for username := range s.bannedUsers {
+		usernames = append(usernames, username)
+	}
+	for ip := range s.bannedIPs {
+		ips = append(ips, ip)
+	}
+	return usernames, ips
+}
+
+func (s *Server) IsUsernameBanned(username string) bool {
+	s.banMu.RLock()
+	defer s.banMu.RUnlock()
+	return s.bannedUsers[username]
+}
+
+func (s *Server) IsIPBanned(ip string) bool {
+	s.banMu.RLock()
+	defer s.banMu.RUnlock()
+	return s.bannedIPs[ip]
+}
+
+// DistributeTo send the current network job to every session of username, returns the number of jobs sent
+func (s *Server) DistributeTo(username string) int {
+	job, err := s.currentJob()
+	if err != nil {
+		logger.Error("%v", err)
+		return 0
+	}
+	return s.sendJobs(job, func(_ net.Conn, session *Session) bool { return session.Username == username })
+}
+
+// CurrentJob job last sent to a session of username, with the extranonce of that session
+func (s *Server) CurrentJob(username string) (protocol.JobParams, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, session := range s.sessions {
+		session.mu.Lock()
+		job := protocol.JobParams{JobID: session.CurrJobID, ServerNonce: session.ServerNonce, Extranonce: session.Extranonce}
+		matched := session.Username == username
+		session.mu.Unlock()
+		if matched && job.ServerNonce != "" {
+			return job, true
+		}
+	}
+	return protocol.JobParams{}, false
+}
+
+// BroadcastJob send a new job to every authorized session right away
+func (s *Server) BroadcastJob() int {
+	return s.distributeAll(true)
+}
+
+// closeSessions close conns matched, handleConnection cleans the sessions up
+func (s *Server) closeSessions(match func(conn net.Conn, session *Session) bool) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	closed := 0
+	for conn, session := range s.sessions {
+		session.mu.Lock()
+		matched := match(conn, session)
+		session.mu.Unlock()
+		if matched {
+			conn.Close()
+			closed++
+		}
+	}
+	return closed
+}
+
+func remoteIP(conn net.Conn) string {
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return conn.RemoteAddr().String()
+	}
+	return host
+}
@@ -0,0 +1,187 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"luxor.tech/tcp_msg_processing_test/pkg/logger"
+)
+
+// maxJobHistory jobs a session may still submit to after newer ones, until a clean job
+const maxJobHistory = 100
+
+// jobWriteTimeout longest write of a job to one client, a client not taking it in time is disconnected
+const jobWriteTimeout = 5 * time.Second
+
+// networkJob server wide job, every session gets it with its own extranonce
+type networkJob struct {
+	ID          int
+	ServerNonce string
+	Tip         string
+	Extranonce  string
+	Clean       bool
+	CreatedAt   time.Time
+}
+
+// jobManager current network job, replaced on schedule or on demand
+type jobManager struct {
+	source  JobSource
+	current networkJob
+	swapped chan struct{} // signaled by setSource, StartJobs subscribes to the changes of the new source
+	mu      sync.Mutex
+}
+
+// next replace the current job by a new one of the source, clean when it builds on another tip or is the first
+func (m *jobManager) next(now time.Time) (networkJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, err := m.source.NextJob()
+	if err != nil {
+		return networkJob{}, err
+	}
+	m.current = networkJob{
+		ID:          m.current.ID + 1,
+		ServerNonce: job.ServerNonce,
+		Tip:         job.Tip,
+		Extranonce:  job.Extranonce,
+		Clean:       m.current.ID == 0 || job.Tip != m.current.Tip,
+		CreatedAt:   now,
+	}
+	return m.current, nil
+}
+
+// get the current job, false before the first one
+func (m *jobManager) get() (networkJob, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.current, m.current.ID != 0
+}
+
+// setSource replace the source of the following jobs
+func (m *jobManager) setSource(source JobSource) {
+	m.mu.Lock()
+	m.source = source
+	m.mu.Unlock()
+	select {
+	case m.swapped <- struct{}{}:
+	default:
+	}
+}
+
+func (m *jobManager) getSource() JobSource {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.source
+}
+
+// newJob make the next network job
+func (s *Server) newJob() (networkJob, error) {
+	job, err := s.jobs.next(s.clock.Now())
+	if err != nil {
+		return networkJob{}, fmt.Errorf("failed to get a job: %v", err)
+	}
+	jobsTotal.WithLabelValues(strconv.FormatBool(job.Clean)).Inc()
+	logger.Debugw("New job", "job_id", job.ID, "clean_jobs", job.Clean)
+	return job, nil
+}
+
+// currentJob the current network job, the first one is made on demand
+func (s *Server) currentJob() (networkJob, error) {
+	if job, ok := s.jobs.get(); ok {
+		return job, nil
+	}
+	return s.newJob()
+}
+
+// extranonce of the session with id, unique among live sessions while fewer than 2^(8*ExtranonceSize) are opened
+func (s *Server) extranonce(id uint64) string {
+	size := min(s.cfg.ExtranonceSize, 8)
+	if size <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("%0*x", size*2, id&(1<<(8*size)-1))
+}
+
+// StartJobs push new network jobs until Close: every JobInterval, and when the job source signals a change once
+// JobDebounce passed without further change, at least JobMinInterval after the previous job. Changes arriving
+// faster than JobDebounce are pushed at the latest max(JobDebounce, JobMinInterval) after the first of them. A job
+// source set while serving is subscribed to in place of the previous one
+func (s *Server) StartJobs() {
+	if s.cfg.JobInterval <= 0 && !s.cfg.JobOnChange {
+		return
+	}
+	changes := s.jobChanges()
+	timer := s.clock.NewTimer(time.Hour)
+	timer.Stop() // armed once a job is due
+	defer timer.Stop()
+
+	last := s.clock.Now()
+	var first, changed time.Time // first and last change not pushed yet, zero when none
+	for {
+		var due time.Time
+		if s.cfg.JobInterval > 0 {
+			due = last.Add(s.cfg.JobInterval)
+		}
+		if !changed.IsZero() {
+			at := changed.Add(s.cfg.JobDebounce)
+			if latest := first.Add(max(s.cfg.JobDebounce, s.cfg.JobMinInterval)); latest.Before(at) {
+				at = latest
+			}
+			if earliest := last.Add(s.cfg.JobMinInterval); at.Before(earliest) {
+				at = earliest
+			}
+			if due.IsZero() || at.Before(due) {
+				due = at
+			}
+		}
+		var wake <-chan time.Time
+		if !due.IsZero() {
+			timer.Reset(due.Sub(s.clock.Now()))
+			wake = timer.C()
+		}
+
+		trigger := "interval"
+		select {
+		case <-s.done:
+			return
+		case <-s.jobs.swapped:
+			changes = s.jobChanges()
+			continue
+		case <-changes:
+			jobSourceChanges.Inc()
+			changed = s.clock.Now()
+			if first.IsZero() {
+				first = changed
+			}
+			continue
+		case <-wake:
+			if !changed.IsZero() {
+				trigger = "change"
+			}
+		}
+		logger.Debugw("Pushing job", "trigger", trigger)
+		s.distributeAll(false)
+		last, first, changed = s.clock.Now(), time.Time{}, time.Time{}
+	}
+}
+
+// jobChanges change signals of the current job source, nil when it sends none or JobOnChange is off
+func (s *Server) jobChanges() <-chan struct{} {
+	if notifier, ok := s.jobs.getSource().(JobNotifier); ok && s.cfg.JobOnChange {
+		return notifier.JobChanges()
+	}
+	return nil
+}
+
+// sendJobOnAuthorize send the current job to a session that just authorized
+func (s *Server) sendJobOnAuthorize(conn net.Conn) {
+	job, err := s.currentJob()
+	if err != nil {
+		logger.Error("%v", err)
+		return
+	}
+	s.sendJobs(job, func(other net.Conn, _ *Session) bool { return other == conn })
+}
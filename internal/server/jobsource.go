@@ -0,0 +1,59 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+// Job work handed to sessions, clients hash its server nonce with their extranonce and client nonce
+type Job struct {
+	ServerNonce string
+	// Tip chain tip the job builds on, a change makes the job clean: work on earlier jobs is abandoned
+	Tip string
+	// Extranonce prefix of every session extranonce on the job, the share of the extranonce space handed down by an
+	// upstream pool when proxying
+	Extranonce string
+}
+
+// JobSource origin of jobs, crypto/rand nonces by default
+type JobSource interface {
+	// NextJob the job to create now, called once per server wide job while sessions wait so it must not block
+	NextJob() (Job, error)
+}
+
+// JobNotifier JobSource signalling new work, e.g. a new block template, so a job is pushed without waiting for the
+// next interval
+type JobNotifier interface {
+	// JobChanges receive a value after the source changed, signals may be coalesced
+	JobChanges() <-chan struct{}
+}
+
+// randomJobs JobSource of unpredictable nonces unrelated to any block
+type randomJobs struct{}
+
+func (randomJobs) NextJob() (Job, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return Job{}, err
+	}
+	return Job{ServerNonce: hex.EncodeToString(nonce)}, nil
+}
+
+// Share accepted submission, with what it takes to check it again or to resubmit it upstream
+type Share struct {
+	Username    string
+	SessionID   uint64
+	JobID       int
+	ServerNonce string
+	Extranonce  string // sent with the job, prefix included
+	ClientNonce string
+	Result      string
+	Time        time.Time
+}
+
+// ShareHandler receives accepted shares, e.g. to forward them to an upstream pool
+type ShareHandler interface {
+	// HandleShare called once per accepted share while its session is locked, so it must not block
+	HandleShare(share Share)
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	connectionsActive = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "tcpmsg_server_connections_active",
+		Help: "Connections currently open.",
+	})
+	connectionsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "tcpmsg_server_connections_total",
+		Help: "Connections accepted since start.",
+	})
+	connectionPanics = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "tcpmsg_server_connection_panics_total",
+		Help: "Connections closed after a recovered panic.",
+	})
+	authorizeTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "tcpmsg_server_authorize_total",
+		Help: "Authorize requests by result.",
+	}, []string{"result"})
+	sharesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "tcpmsg_server_shares_total",
+		Help: "Submitted shares by result and reject reason.",
+	}, []string{"result", "reason"})
+	submitDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "tcpmsg_server_submit_duration_seconds",
+		Help:    "Submit handling latency.",
+		Buckets: prometheus.ExponentialBuckets(0.0001, 4, 8),
+	})
+	jobsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "tcpmsg_server_jobs_total",
+		Help: "Server wide jobs created, by clean_jobs flag.",
+	}, []string{"clean"})
+	jobSourceChanges = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "tcpmsg_server_job_source_changes_total",
+		Help: "Change signals of the job source, debounced into job pushes.",
+	})
+	jobBroadcastDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "tcpmsg_server_job_broadcast_duration_seconds",
+		Help:    "Time to send a job round to all sessions.",
+		Buckets: prometheus.ExponentialBuckets(0.0001, 4, 10),
+	})
+	dbUpsertDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "tcpmsg_server_db_upsert_duration_seconds",
+		Help:    "Submission statistics upsert latency.",
+		Buckets: prometheus.ExponentialBuckets(0.0005, 4, 8),
+	})
+	dbUpsertErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "tcpmsg_server_db_upsert_errors_total",
+		Help: "Failed submission statistics upserts.",
+	})
+	jobWriteDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "tcpmsg_server_job_write_duration_seconds",
+		Help:    "Time spent writing one job to one session.",
+		Buckets: prometheus.ExponentialBuckets(0.00001, 4, 10),
+	})
+	jobSendFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "tcpmsg_server_job_send_failures_total",
+		Help: "Jobs that could not be written, their session is closed.",
+	})
+)
@@ -0,0 +1,150 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"sort"
+	"sync/atomic"
+
+	"luxor.tech/tcp_msg_processing_test/internal/record"
+	"luxor.tech/tcp_msg_processing_test/pkg/clock"
+	"luxor.tech/tcp_msg_processing_test/pkg/logger"
+)
+
+var ErrRecordingDisabled = errors.New("recording disabled, no record_dir configured")
+
+// recordConn conn writing its traffic to a recording while one is attached, wraps every conn when RecordDir is set
+type recordConn struct {
+	net.Conn
+	clock  clock.Clock
+	writer atomic.Pointer[record.Writer]
+}
+
+func (c *recordConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	if n > 0 {
+		c.record(record.Out, p[:n])
+	}
+	return n, err
+}
+
+func (c *recordConn) record(dir record.Direction, data []byte) {
+	w := c.writer.Load()
+	if w == nil {
+		return
+	}
+	if err := w.Write(c.clock.Now(), dir, data); err != nil {
+		logger.Warnw("Recording failed, stopped", "remote_addr", c.RemoteAddr().String(), "path", w.Path(), "err", err)
+		c.detach(w)
+	}
+}
+
+// detach stop recording into w when it is still the attached writer
+func (c *recordConn) detach(w *record.Writer) {
+	if w != nil && c.writer.CompareAndSwap(w, nil) {
+		_ = w.Close()
+	}
+}
+
+// Record write the traffic of every connection authorized as username to a file in RecordDir, live connections
+// are recorded from their next frame
+func (s *Server) Record(username string) error {
+	if s.cfg.RecordDir == "" {
+		return ErrRecordingDisabled
+	}
+	s.mu.Lock()
+	s.recordUsers[username] = true
+	var live []net.Conn
+	for conn, session := range s.sessions {
+		session.mu.Lock()
+		if session.Username == username {
+			live = append(live, conn)
+		}
+		session.mu.Unlock()
+	}
+	s.mu.Unlock()
+	for _, conn := range live {
+		s.startRecording(conn, "")
+	}
+	return nil
+}
+
+// StopRecording stop recording username and close its open recordings
+func (s *Server) StopRecording(username string) {
+	s.mu.Lock()
+	delete(s.recordUsers, username)
+	var live []*recordConn
+	for conn, session := range s.sessions {
+		session.mu.Lock()
+		if rc, ok := conn.(*recordConn); ok && session.Username == username {
+			live = append(live, rc)
+		}
+		session.mu.Unlock()
+	}
+	s.mu.Unlock()
+	for _, rc := range live {
+		rc.detach(rc.writer.Load())
+	}
+}
+
+// Recordings usernames being recorded
+func (s *Server) Recordings() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	usernames := make([]string, 0, len(s.recordUsers))
+	for username := range s.recordUsers {
+		usernames = append(usernames, username)
+	}
+	sort.Strings(usernames)
+	return usernames
+}
+
+func (s *Server) isRecorded(username string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.recordUsers[username]
+}
+
+// startRecording attach a recording to conn unless one is, first is the inbound frame that triggered it
+func (s *Server) startRecording(conn net.Conn, first string) {
+	rc, ok := conn.(*recordConn)
+	if !ok || rc.writer.Load() != nil {
+		return
+	}
+	s.mu.RLock()
+	session, exist := s.sessions[conn]
+	s.mu.RUnlock()
+	if !exist {
+		return
+	}
+	session.mu.Lock()
+	header := record.Header{SessionID: session.ID, Username: session.Username, RemoteAddr: conn.RemoteAddr().String(), Started: s.clock.Now()}
+	session.mu.Unlock()
+	w, err := record.Create(s.cfg.RecordDir, header)
+	if err != nil {
+		logger.Errorw("Failed to create recording", "session_id", header.SessionID, "username", header.Username, "err", err)
+		return
+	}
+	if !rc.writer.CompareAndSwap(nil, w) {
+		_ = w.Close()
+		return
+	}
+	logger.Infow("Recording session", "session_id", header.SessionID, "username", header.Username, "path", w.Path())
+	if first != "" {
+		rc.record(record.In, []byte(first+"\n"))
+	}
+}
+
+// recordInbound record a message read from conn
+func recordInbound(conn net.Conn, message string) {
+	if rc, ok := conn.(*recordConn); ok {
+		rc.record(record.In, []byte(message+"\n"))
+	}
+}
+
+// stopRecording close the recording of a closed conn
+func stopRecording(conn net.Conn) {
+	if rc, ok := conn.(*recordConn); ok {
+		rc.detach(rc.writer.Load())
+	}
+}
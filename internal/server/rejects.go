@@ -0,0 +1,93 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"luxor.tech/tcp_msg_processing_test/pkg/logger"
+)
+
+// maxPendingRejects bound of buffered counters kept across failed flushes
+const maxPendingRejects = 100_000
+
+type rejectKey struct {
+	Username string
+	Minute   time.Time
+	Reason   string
+}
+
+// rejectRecorder buffer rejected share counters in memory, flushed to the database in batches
+// so a flood of bad shares costs one upsert per user/minute/reason
+type rejectRecorder struct {
+	counts map[rejectKey]int
+	mu     sync.Mutex
+}
+
+func newRejectRecorder() *rejectRecorder {
+	return &rejectRecorder{counts: make(map[rejectKey]int)}
+}
+
+func (r *rejectRecorder) Add(username string, minute time.Time, reason string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := rejectKey{Username: username, Minute: minute, Reason: reason}
+	if _, exist := r.counts[key]; !exist && len(r.counts) >= maxPendingRejects {
+		return // database unreachable for long, drop rather than grow unbounded
+	}
+	r.counts[key]++
+}
+
+// Flush write buffered counters, failed ones are kept for the next flush
+func (r *rejectRecorder) Flush(ctx context.Context, store Store) error {
+	r.mu.Lock()
+	counts := r.counts
+	r.counts = make(map[rejectKey]int)
+	r.mu.Unlock()
+
+	var firstErr error
+	for key, count := range counts {
+		if firstErr == nil {
+			firstErr = store.UpsertRejection(ctx, key.Username, key.Minute, key.Reason, count)
+			if firstErr == nil {
+				delete(counts, key)
+			}
+		}
+	}
+	if len(counts) == 0 {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for key, count := range counts {
+		if _, exist := r.counts[key]; exist || len(r.counts) < maxPendingRejects {
+			r.counts[key] += count
+		}
+	}
+	return firstErr
+}
+
+// StartRejectFlush flush rejected share counters periodically
+func (s *Server) StartRejectFlush() {
+	if s.cfg.RejectFlushInterval <= 0 {
+		return
+	}
+	ticker := s.clock.NewTicker(s.cfg.RejectFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C():
+		}
+		s.FlushRejects()
+	}
+}
+
+// FlushRejects write buffered rejected share counters to the store now
+func (s *Server) FlushRejects() {
+	if err := s.rejects.Flush(context.Background(), s.store); err != nil {
+		logger.Warn("Failed to record rejected shares, retry later: %v", err)
+	}
+}
@@ -2,182 +2,416 @@ package server
 
 import (
 	"bufio"
-	"crypto/sha256"
-	"encoding/hex"
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"math/rand"
 	"net"
+	"net/http"
+	"runtime/debug"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+
+	"luxor.tech/tcp_msg_processing_test/internal/protocol"
+	"luxor.tech/tcp_msg_processing_test/internal/spool"
+	"luxor.tech/tcp_msg_processing_test/pkg/clock"
 	"luxor.tech/tcp_msg_processing_test/pkg/logger"
 	"luxor.tech/tcp_msg_processing_test/pkg/util"
 )
 
 type Server struct {
+	cfg      Config
+	tlsOnce  sync.Once
+	tls      *tls.Config
+	tlsErr   error
+	certs    *certReloader
+	spool    *spool.Spool // accepted shares waiting for the database
+	rejects  *rejectRecorder
+	store    Store
+	jobs     *jobManager
+	shares   ShareHandler // nil when accepted shares go nowhere else than the store
+	clock    clock.Clock
 	sessions map[net.Conn]*Session // maintain client sessions
 	mu       sync.RWMutex
+	jobMu    sync.Mutex // serializes sendJobs
+
+	listeners   []net.Listener
+	httpServers []*http.Server // websocket endpoints, closed with the listeners
+	done        chan struct{}  // closed by Close, stops background loops
+	closeOnce   sync.Once
+
+	bannedUsers map[string]bool
+	bannedIPs   map[string]bool
+	banMu       sync.RWMutex
+
+	recordUsers map[string]bool // usernames whose connections are recorded, guarded by mu
 }
 
 func NewServer() *Server {
+	return NewServerWithConfig(DefaultConfig())
+}
+
+func NewServerWithConfig(cfg Config) *Server {
 	return &Server{
-		sessions: make(map[net.Conn]*Session),
+		cfg:         cfg,
+		sessions:    make(map[net.Conn]*Session),
+		bannedUsers: make(map[string]bool),
+		bannedIPs:   make(map[string]bool),
+		recordUsers: make(map[string]bool),
+		rejects:     newRejectRecorder(),
+		store:       dbStore{},
+		jobs:        &jobManager{source: randomJobs{}, swapped: make(chan struct{}, 1)},
+		clock:       clock.Real,
+		done:        make(chan struct{}),
 	}
 }
 
+// SetClock replace the wall clock driving rate limits, minute buckets, keepalive and periodic jobs,
+// call before serving
+func (s *Server) SetClock(c clock.Clock) {
+	s.clock = c
+}
+
+// SetJobSource replace the random nonces as origin of jobs, the following jobs come from source and its changes are
+// pushed from then on
+func (s *Server) SetJobSource(source JobSource) {
+	s.jobs.setSource(source)
+}
+
+// SetShareHandler hand every accepted share to handler as well, call before serving
+func (s *Server) SetShareHandler(handler ShareHandler) {
+	s.shares = handler
+}
+
+// SetStore replace the database as share statistics store, call before serving
+func (s *Server) SetStore(store Store) {
+	s.store = store
+}
+
 func (s *Server) Start(port string) error {
-	listener, err := net.Listen("tcp", port)
+	lc := net.ListenConfig{KeepAlive: s.cfg.TCPKeepAlive}
+	listener, err := lc.Listen(context.Background(), "tcp", port)
 	if err != nil {
 		logger.Error("Failed to start server:%v", err)
 		return err
 	}
+	return s.Serve(listener)
+}
+
+// Serve accept clients on listener until Close, tls is layered on when configured
+func (s *Server) Serve(listener net.Listener) error {
 	defer listener.Close()
 
-	logger.Info("Server is listening on port:%v", port)
+	if s.cfg.TLS != nil {
+		tlsConfig, err := s.getTLSConfig()
+		if err != nil {
+			logger.Error("Failed to load tls config:%v", err)
+			return err
+		}
+		listener = tls.NewListener(listener, tlsConfig)
+	}
+
+	var err error
+	if s.cfg.SpoolFile != "" {
+		if s.spool, err = spool.Open(s.cfg.SpoolFile, s.cfg.SpoolMaxBytes); err != nil {
+			logger.Error("Failed to open spool:%v", err)
+			return err
+		}
+		go s.StartSpoolReplay()
+	}
 
-	go s.StartTaskDistribution(time.Second*30, 0)
+	s.mu.Lock()
+	s.listeners = append(s.listeners, listener)
+	s.mu.Unlock()
+	logger.Info("Server is listening on port:%v, tls:%v", listener.Addr(), s.cfg.TLS != nil)
+
+	go s.StartJobs()
+	go s.StartKeepalive()
+	go s.StartRejectFlush()
 
 	// handle client requests: reactor model
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
-			logger.Info("Error accepting connection:%v", err)
+			select {
+			case <-s.done:
+				return nil
+			default:
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return err
+			}
+			logger.Warn("Error accepting connection:%v", err)
 			continue
 		}
 
-		logger.Info("New client connected:%v", conn.RemoteAddr())
+		s.ServeConn(conn)
+	}
+}
+
+// Close stop listening on tcp and websocket and background loops, disconnect every client, flush rejected share counters and close
+// the spool
+func (s *Server) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.done)
 		s.mu.Lock()
-		s.sessions[conn] = NewSession()
+		for _, listener := range s.listeners {
+			listener.Close()
+		}
+		for _, httpServer := range s.httpServers {
+			httpServer.Close()
+		}
+		spool := s.spool
 		s.mu.Unlock()
+		s.closeSessions(func(net.Conn, *Session) bool { return true })
+		s.FlushRejects()
+		if spool != nil {
+			if err := spool.Close(); err != nil {
+				logger.Error("Failed to close spool:%v", err)
+			}
+		}
+	})
+	return nil
+}
+
+// Done closed once Close is called, for services that live as long as the server
+func (s *Server) Done() <-chan struct{} {
+	return s.done
+}
 
-		// handle connection
-		go s.handleConnection(conn)
+// ServeConn register a session for an accepted conn and handle it in background
+func (s *Server) ServeConn(conn net.Conn) {
+	if s.IsIPBanned(remoteIP(conn)) {
+		logger.Info("Rejected banned client:%v", conn.RemoteAddr())
+		conn.Close()
+		return
 	}
+	if s.cfg.RecordDir != "" {
+		conn = &recordConn{Conn: conn, clock: s.clock}
+	}
+	session := NewSession(s.clock.Now())
+	session.Extranonce = s.extranonce(session.ID)
+	logger.Infow("New client connected", "remote_addr", conn.RemoteAddr().String(), "session_id", session.ID)
+	s.mu.Lock()
+	s.sessions[conn] = session
+	s.mu.Unlock()
+
+	// handle connection
+	go s.handleConnection(conn)
 }
 
 func (s *Server) handleConnection(conn net.Conn) {
+	connectionsActive.Inc()
+	connectionsTotal.Inc()
 	defer func() {
+		connectionsActive.Dec()
 		s.mu.Lock()
 		delete(s.sessions, conn)
 		s.mu.Unlock()
 		conn.Close()
+		stopRecording(conn)
 		logger.Info("Client disconnected:%v", conn.RemoteAddr())
 	}()
+	defer s.recoverConn(conn)
 
 	reader := bufio.NewReader(conn)
 	for {
+		if s.cfg.IdleTimeout > 0 {
+			_ = conn.SetReadDeadline(time.Now().Add(s.cfg.IdleTimeout))
+		}
 		// read a complete message
 		message, err := reader.ReadString('\n') // delimiter based protocol
 		if err != nil {
 			return
 		}
 		message = strings.TrimSpace(message)
+		s.touchSession(conn)
+		recordInbound(conn, message)
 
 		// handle one request
 		s.processRequest(conn, message)
 	}
 }
 
+// recoverConn confine a panic to the connection it happened on, which is then closed
+func (s *Server) recoverConn(conn net.Conn) {
+	if r := recover(); r != nil {
+		connectionPanics.Inc()
+		logger.Errorw("Recovered from panic, closing connection", "remote_addr", conn.RemoteAddr().String(),
+			"panic", fmt.Sprint(r), "stack", string(debug.Stack()))
+	}
+}
+
 func (s *Server) processRequest(conn net.Conn, message string) {
 	var req Request
 
 	err := json.Unmarshal([]byte(message), &req)
 	if err != nil {
-		logger.Error("Invalid request:%v", err)
+		logger.Warnw("Invalid request", "remote_addr", conn.RemoteAddr().String(), "err", err)
 		SendErrorResponse(conn, req.ID, "unknown request")
 		return
 	}
 
+	s.mu.RLock()
+	if session, exist := s.sessions[conn]; exist {
+		session.mu.Lock()
+		logger.Debugw("Request received", "session_id", session.ID, "username", session.Username, "message", message)
+		session.mu.Unlock()
+	}
+	s.mu.RUnlock()
+
 	switch req.Method {
 	case "authorize":
 		s.mu.RLock()
-		session := s.sessions[conn]
+		session, exist := s.sessions[conn]
 		s.mu.RUnlock()
-		uname, exist := req.Params["username"]
 		if !exist {
-			s.mu.Unlock()
+			return // closed meanwhile
+		}
+		var params protocol.AuthorizeParams
+		if err := protocol.Decode(req.Params, &params); err != nil {
+			authorizeTotal.WithLabelValues("fail").Inc()
+			SendErrorResponse(conn, req.ID, err.Error())
+			return
+		}
+		if s.IsUsernameBanned(params.Username) {
+			authorizeTotal.WithLabelValues("fail").Inc()
+			SendErrorResponse(conn, req.ID, "User banned")
+			conn.Close()
 			return
 		}
-		session.Username = uname.(string)
+		session.mu.Lock()
+		session.Username = params.Username
+		session.mu.Unlock()
+		if s.isRecorded(params.Username) {
+			s.startRecording(conn, message)
+		}
+		authorizeTotal.WithLabelValues("success").Inc()
 		SendSuccessResponse(conn, req.ID)
+		if s.cfg.JobOnAuthorize {
+			s.sendJobOnAuthorize(conn)
+		}
 	case "submit":
 		s.handleSubmit(conn, req)
+	case "ping":
+		SendPong(conn, req.ID)
+	case "pong":
+		// liveness already recorded by touchSession
+	}
+}
+
+// touchSession record inbound activity of conn
+func (s *Server) touchSession(conn net.Conn) {
+	s.mu.RLock()
+	session, exist := s.sessions[conn]
+	s.mu.RUnlock()
+	if !exist {
+		return
 	}
+	session.mu.Lock()
+	session.LastSeen = s.clock.Now()
+	session.mu.Unlock()
 }
 
 func (s *Server) handleSubmit(conn net.Conn, req Request) {
-	// Parse request parameters
-	params := req.Params
+	defer prometheus.NewTimer(submitDuration).ObserveDuration()
 
-	jobID, ok := util.IntValue(params["job_id"])
-	clientNonce, ok1 := util.StringValue(params["client_nonce"])
-	result, ok2 := util.StringValue(params["result"])
-	if !ok || !ok1 || !ok2 {
-		SendErrorResponse(conn, req.ID, "Missing required parameters")
+	// Parse request parameters
+	var params protocol.SubmitParams
+	if err := protocol.Decode(req.Params, &params); err != nil {
+		reason := "Invalid parameters"
+		if errors.Is(err, protocol.ErrMissingParams) {
+			reason = err.Error()
+		}
+		sharesTotal.WithLabelValues("rejected", reason).Inc()
+		SendErrorResponse(conn, req.ID, err.Error())
 		return
 	}
+	jobID, clientNonce, result := params.JobID, params.ClientNonce, params.Result
 
 	// Lock server tasks for thread-safe access
 	s.mu.RLock()
 	session, e := s.sessions[conn]
 	s.mu.RUnlock()
 	if !e {
+		sharesTotal.WithLabelValues("rejected", "Task does not exist").Inc()
 		SendErrorResponse(conn, req.ID, "Task does not exist")
 		return
 	}
 	session.mu.Lock()
 	defer session.mu.Unlock()
+	reject := func(reason string) {
+		logger.Debugw("Share rejected", "session_id", session.ID, "username", session.Username, "job_id", jobID, "reason", reason)
+		session.Rejected++
+		sharesTotal.WithLabelValues("rejected", reason).Inc()
+		if session.Username != "" {
+			s.rejects.Add(session.Username, s.clock.Now().UTC().Truncate(time.Minute), reason)
+		}
+		SendErrorResponse(conn, req.ID, reason)
+	}
 
 	// authorize
 	if session.Username == "" {
-		SendErrorResponse(conn, req.ID, "Not authorized")
+		reject("Not authorized")
 		return
 	}
 
-	// job_id
-	if session.CurrJobID != jobID {
-		SendErrorResponse(conn, req.ID, "Task does not exist")
+	// job_id, any job sent since the last clean one
+	job, sent := session.SentJob(jobID)
+	if !sent {
+		reject("Task does not exist")
 		return
 	}
 
 	// Validate duplicate nonce
 	if _, submitted := session.Submissions[clientNonce]; submitted {
-		SendErrorResponse(conn, req.ID, "Duplicate submission")
+		reject("Duplicate submission")
 		return
 	}
 
 	// Validate rate limit
-	if time.Since(session.LastSubmit) < time.Second {
-		SendErrorResponse(conn, req.ID, "Submission too frequent")
+	if s.clock.Since(session.LastSubmit) < time.Second {
+		reject("Submission too frequent")
 		return
 	}
 
-	expectedHash := calculateSHA256(session.ServerNonce + clientNonce)
+	expectedHash := protocol.Result(job.ServerNonce, job.Extranonce, clientNonce)
 	if expectedHash != result {
-		SendErrorResponse(conn, req.ID, "Invalid result")
+		reject("Invalid result")
 		return
 	}
 
 	// Mark submission as processed
 	session.Submissions[clientNonce] = true
-	session.LastSubmit = time.Now()
+	now := s.clock.Now()
+	session.LastSubmit = now
+	session.Accepted++
+	sharesTotal.WithLabelValues("accepted", "").Inc()
 	// Update statistics after successful submission
-	_ = session.StoreSuccSubmission()
+	minute := now.UTC().Truncate(time.Minute)
+	if err := session.StoreSuccSubmission(s.store, minute); err != nil {
+		s.spoolSubmission(session.Username, minute, err)
+	}
+	if s.shares != nil {
+		s.shares.HandleShare(Share{
+			Username:    session.Username,
+			SessionID:   session.ID,
+			JobID:       jobID,
+			ServerNonce: job.ServerNonce,
+			Extranonce:  job.Extranonce,
+			ClientNonce: clientNonce,
+			Result:      result,
+			Time:        now,
+		})
+	}
 
 	// Send success response
 	SendSuccessResponse(conn, req.ID)
-	logger.Info("Client %v submitted job %d with nonce %s", conn.RemoteAddr(), jobID, clientNonce)
-}
-
-func calculateSHA256(input string) string {
-	hash := sha256.Sum256([]byte(input))
-	return hex.EncodeToString(hash[:])
-}
-
-func GenerateServerNonce() string {
-	return fmt.Sprintf("%d", rand.Int63())
+	logger.With("session_id", session.ID, "username", session.Username, "job_id", jobID).Info("Client %v submitted with nonce %s", conn.RemoteAddr(), clientNonce)
 }
 
 func SendErrorResponse(conn net.Conn, id *int, errorMsg string) {
@@ -198,63 +432,182 @@ func SendSuccessResponse(conn net.Conn, id *int) {
 	_, _ = conn.Write(append(data, '\n'))
 }
 
+func SendPing(conn net.Conn) error {
+	data, _ := json.Marshal(Request{ID: util.GenerateID(), Method: "ping"})
+	_, err := conn.Write(append(data, '\n'))
+	return err
+}
+func SendPong(conn net.Conn, id *int) {
+	data, _ := json.Marshal(Request{ID: id, Method: "pong"})
+	_, _ = conn.Write(append(data, '\n'))
+}
+
+// StartKeepalive ping idle sessions and reap the ones never authorized
+func (s *Server) StartKeepalive() {
+	interval := s.cfg.PingInterval
+	if interval <= 0 || (s.cfg.AuthTimeout > 0 && s.cfg.AuthTimeout < interval) {
+		interval = s.cfg.AuthTimeout
+	}
+	if interval <= 0 {
+		return
+	}
+	ticker := s.clock.NewTicker(interval / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C():
+		}
+		s.CheckSessions(s.clock.Now())
+	}
+}
+
+func (s *Server) CheckSessions(now time.Time) {
+	s.mu.RLock()
+	sessions := make(map[net.Conn]*Session, len(s.sessions))
+	for conn, session := range s.sessions {
+		sessions[conn] = session
+	}
+	s.mu.RUnlock()
+
+	for conn, session := range sessions {
+		session.mu.Lock()
+		unauthorized := session.Username == "" && now.Sub(session.ConnectedAt) >= s.cfg.AuthTimeout
+		idle := now.Sub(session.LastSeen) >= s.cfg.PingInterval
+		session.mu.Unlock()
+
+		switch {
+		case s.cfg.AuthTimeout > 0 && unauthorized:
+			logger.Info("Reaping unauthorized session:%v", conn.RemoteAddr())
+			conn.Close() // handleConnection cleans the session up
+		case s.cfg.PingInterval > 0 && idle:
+			if err := SendPing(conn); err != nil {
+				logger.Error("Failed to ping client %v:%v", conn.RemoteAddr(), err)
+				conn.Close()
+			}
+		}
+	}
+}
+
+// StartTaskDistribution send a new job to every session each interval, times rounds or until Close when 0.
+// A zero interval disables periodic jobs, they are then sent by BroadcastJob only
 func (s *Server) StartTaskDistribution(interval time.Duration, times int) {
-	ticker := time.NewTicker(interval)
+	if interval <= 0 {
+		return
+	}
+	ticker := s.clock.NewTicker(interval)
 	defer ticker.Stop()
 
 	if times > 0 {
 		for i := 0; i < times; i++ {
-			<-ticker.C
-			s.mu.Lock()
-			for conn, session := range s.sessions {
-				s.DistributionJob(conn, session)
-			}
-			s.mu.Unlock()
+			<-ticker.C()
+			s.distributeAll(false)
 		}
 		logger.Info("Task distribution completed.")
 		return
 	}
-	for range ticker.C {
-		s.mu.Lock()
-		for conn, session := range s.sessions {
-			s.DistributionJob(conn, session)
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C():
 		}
-		s.mu.Unlock()
+		s.distributeAll(false)
 	}
 }
 
-func (s *Server) DistributionJob(conn net.Conn, session *Session) {
-	session.mu.Lock()
-	defer session.mu.Unlock()
+// distributeAll send a new network job to every session, or only authorized ones, returns jobs sent
+func (s *Server) distributeAll(authorizedOnly bool) int {
+	defer prometheus.NewTimer(jobBroadcastDuration).ObserveDuration()
+	job, err := s.newJob()
+	if err != nil {
+		logger.Error("%v", err)
+		return 0
+	}
+	return s.sendJobs(job, func(_ net.Conn, session *Session) bool {
+		return !authorizedOnly || session.Username != ""
+	})
+}
 
-	session.CurrJobID++
-	session.ServerNonce = GenerateServerNonce()
+// sendJobs send job to the sessions matched, returns jobs sent. Sessions are picked under s.mu and written outside
+// it, concurrently and each within jobWriteTimeout, so a slow client neither holds the lock nor delays the others.
+// jobMu keeps a session receiving its jobs in the order they were assigned
+func (s *Server) sendJobs(job networkJob, match func(conn net.Conn, session *Session) bool) int {
+	s.jobMu.Lock()
+	defer s.jobMu.Unlock()
 
-	session.GetJob()
-	session.CleanExpireJobHistory(100)
+	type send struct {
+		conn    net.Conn
+		message []byte
+	}
+	var sends []send
+	s.mu.RLock()
+	for conn, session := range s.sessions {
+		session.mu.Lock()
+		if match(conn, session) {
+			sends = append(sends, send{conn: conn, message: s.assignJob(session, job)})
+		}
+		session.mu.Unlock()
+	}
+	s.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	for _, send := range sends {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			writeJob(send.conn, send.message)
+		}()
+	}
+	wg.Wait()
+	return len(sends)
+}
+
+// assignJob make job the current one of session and return its message, session.mu must be held. A clean job
+// drops the earlier jobs and the client nonces submitted to them
+func (s *Server) assignJob(session *Session, job networkJob) []byte {
+	extranonce := job.Extranonce + session.Extranonce
+	if session.CurrJobID != job.ID {
+		if job.Clean {
+			session.JobHistory = session.JobHistory[:0]
+			session.Submissions = make(map[string]bool)
+		}
+		session.CurrJobID = job.ID
+		session.ServerNonce = job.ServerNonce
+		session.GetJob(extranonce)
+		session.CleanExpireJobHistory(maxJobHistory)
+	}
 
 	task := Request{
 		Method: "job",
-		Params: map[string]interface{}{
-			"job_id":       session.CurrJobID,
-			"server_nonce": session.ServerNonce,
-		},
+		Params: protocol.Encode(&protocol.JobParams{
+			JobID:       job.ID,
+			ServerNonce: job.ServerNonce,
+			Extranonce:  extranonce,
+			CleanJobs:   job.Clean,
+		}),
 	}
-
 	message, _ := json.Marshal(task)
-	_, err := conn.Write(append(message, '\n'))
+	logger.Debugw("Job sent", "session_id", session.ID, "username", session.Username, "job_id", job.ID)
+	return append(message, '\n')
+}
+
+// writeJob write a job message within jobWriteTimeout, a client failing it is closed and handleConnection drops
+// its session
+func writeJob(conn net.Conn, message []byte) {
+	_ = conn.SetWriteDeadline(time.Now().Add(jobWriteTimeout))
+	timer := prometheus.NewTimer(jobWriteDuration)
+	_, err := conn.Write(message)
+	timer.ObserveDuration()
+	_ = conn.SetWriteDeadline(time.Time{})
 	if err != nil {
-		logger.Error("Failed to send job to client:", err) // set client ill
-		delete(s.sessions, conn)
+		jobSendFailures.Inc()
+		logger.Error("Failed to send job to client:%v", err) // set client ill
 		conn.Close()
 	}
 }
+
 func (s *Server) DistributionToForTest(userName string) {
-	s.mu.Lock()
-	for conn, session := range s.sessions {
-		if session.Username == userName {
-			s.DistributionJob(conn, session)
-		}
-	}
-	s.mu.Unlock()
+	s.DistributeTo(userName)
 }
@@ -1,60 +1,85 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+
 	"luxor.tech/tcp_msg_processing_test/pkg/logger"
-	rds_db "luxor.tech/tcp_msg_processing_test/rds-db"
 )
 
 // Session for client
 type Session struct {
+	ID       uint64
 	Username string
 
 	CurrJobID   int
 	ServerNonce string
+	Extranonce  string          // hashed between server and client nonces, distinct per session
 	Submissions map[string]bool // can extract to service/cache
 	LastSubmit  time.Time
 
 	JobHistory []TaskHistory
 
+	ConnectedAt time.Time
+	LastSeen    time.Time // last inbound message
+
+	Accepted int64
+	Rejected int64
+
 	mu sync.Mutex
 }
 
-func (s *Session) StoreSuccSubmission() interface{} {
+// StoreSuccSubmission count one accepted share in the minute bucket of the user
+func (s *Session) StoreSuccSubmission(store Store, minute time.Time) error {
 	// incre submission count: can store in cache, async to db, could be bottle snake
-	now := time.Now().UTC().Truncate(time.Minute)
-	query := `
-		INSERT INTO submissions (username, timestamp, submission_count)
-		VALUES ($1, $2, 1)
-		ON CONFLICT (username, timestamp)
-		DO UPDATE SET submission_count = submissions.submission_count + 1;
-	`
-	_, err := rds_db.GetDb().Exec(query, s.Username, now)
+	timer := prometheus.NewTimer(dbUpsertDuration)
+	err := store.UpsertSubmission(context.Background(), s.Username, minute, 1)
+	timer.ObserveDuration()
 	if err != nil {
-		return fmt.Errorf("failed to update statistics for user %s: %v", s.Username, err)
+		dbUpsertErrors.Inc()
+		return fmt.Errorf("failed to update statistics for user %s: %w", s.Username, err)
 	}
-	logger.Info("Updated statistics for user %s", s.Username)
+	logger.Debugw("Updated statistics", "username", s.Username, "minute", minute)
 	return nil
 }
 
-// GetJob can flash to mq
-func (s *Session) GetJob() {
+// GetJob can flash to mq, extranonce is the one sent with the current job
+func (s *Session) GetJob(extranonce string) {
 	s.JobHistory = append(s.JobHistory, TaskHistory{
 		JobID:       s.CurrJobID,
 		ServerNonce: s.ServerNonce,
+		Extranonce:  extranonce,
 	})
 }
+
+// SentJob a job sent to the session and still accepted
+func (s *Session) SentJob(jobID int) (TaskHistory, bool) {
+	for i := len(s.JobHistory) - 1; i >= 0; i-- {
+		if s.JobHistory[i].JobID == jobID {
+			return s.JobHistory[i], true
+		}
+	}
+	return TaskHistory{}, false
+}
+
 func (s *Session) CleanExpireJobHistory(maxLength int) {
 	if len(s.JobHistory) > maxLength {
 		s.JobHistory = s.JobHistory[len(s.JobHistory)-maxLength:]
 	}
 }
 
-func NewSession() *Session {
+var sessionIDGen atomic.Uint64
+
+func NewSession(now time.Time) *Session {
 	return &Session{
+		ID:          sessionIDGen.Add(1),
+		ConnectedAt: now,
+		LastSeen:    now,
 		JobHistory:  make([]TaskHistory, 0),
 		Submissions: make(map[string]bool),
 	}
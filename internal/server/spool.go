@@ -0,0 +1,63 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"luxor.tech/tcp_msg_processing_test/internal/spool"
+	"luxor.tech/tcp_msg_processing_test/pkg/logger"
+	rds_db "luxor.tech/tcp_msg_processing_test/rds-db"
+)
+
+// spoolSubmission keep a share the database write failed for, to be replayed later. Only writes that certainly did
+// not run are spooled, an ambiguous failure like a timeout may have committed and a replay would count it twice
+func (s *Server) spoolSubmission(username string, minute time.Time, dbErr error) {
+	if !rds_db.IsTransient(dbErr) {
+		logger.Errorw("Share statistics lost, write may have committed", "username", username, "minute", minute, "err", dbErr)
+		return
+	}
+	if s.spool == nil {
+		logger.Errorw("Share statistics lost", "username", username, "minute", minute, "err", dbErr)
+		return
+	}
+	if err := s.spool.Append(spool.NewRecord(username, minute, 1)); err != nil {
+		logger.Errorw("Share statistics lost, spool append failed", "username", username, "minute", minute, "err", err, "db_err", dbErr)
+		return
+	}
+	logger.Warnw("Share statistics spooled", "username", username, "minute", minute, "db_err", dbErr)
+}
+
+// StartSpoolReplay replay spooled shares periodically until the spool drains
+func (s *Server) StartSpoolReplay() {
+	if s.cfg.SpoolReplayInterval <= 0 {
+		return
+	}
+	ticker := s.clock.NewTicker(s.cfg.SpoolReplayInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C():
+		}
+		s.ReplaySpool()
+	}
+}
+
+// ReplaySpool push spooled shares to the database, returns the number replayed
+func (s *Server) ReplaySpool() int {
+	if s.spool == nil || s.spool.Len() == 0 {
+		return 0
+	}
+	replayed, err := s.spool.Replay(func(rec spool.Record) error {
+		_, err := s.store.ReplaySubmission(context.Background(), rec.ID, rec.Username, rec.Minute, rec.Count)
+		return err
+	})
+	if replayed > 0 {
+		logger.Info("Replayed %d spooled shares, %d pending", replayed, s.spool.Len())
+	}
+	if err != nil {
+		logger.Warn("Spool replay paused: %v", err)
+	}
+	return replayed
+}
@@ -0,0 +1,33 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	rds_db "luxor.tech/tcp_msg_processing_test/rds-db"
+)
+
+// Store persistence of share statistics, the database by default
+type Store interface {
+	// UpsertSubmission add count accepted shares of username to its minute bucket
+	UpsertSubmission(ctx context.Context, username string, minute time.Time, count int) error
+	// ReplaySubmission apply a spooled share once, false when id was already replayed
+	ReplaySubmission(ctx context.Context, id, username string, minute time.Time, count int) (bool, error)
+	// UpsertRejection add count rejected shares of username for reason to its minute bucket
+	UpsertRejection(ctx context.Context, username string, minute time.Time, reason string, count int) error
+}
+
+// dbStore Store backed by rds_db
+type dbStore struct{}
+
+func (dbStore) UpsertSubmission(ctx context.Context, username string, minute time.Time, count int) error {
+	return rds_db.UpsertSubmission(ctx, username, minute, count)
+}
+
+func (dbStore) ReplaySubmission(ctx context.Context, id, username string, minute time.Time, count int) (bool, error) {
+	return rds_db.ReplaySubmission(ctx, id, username, minute, count)
+}
+
+func (dbStore) UpsertRejection(ctx context.Context, username string, minute time.Time, reason string, count int) error {
+	return rds_db.UpsertRejection(ctx, username, minute, reason, count)
+}
@@ -1,15 +1,21 @@
 package server
 
-// TaskHistory task mapping: <job_id, server_nonce>
+import (
+	"encoding/json"
+	"time"
+)
+
+// TaskHistory task mapping: <job_id, server_nonce, extranonce>
 type TaskHistory struct {
 	JobID       int
 	ServerNonce string
+	Extranonce  string // sent with the job: its prefix and the session extranonce
 }
 
 type Request struct {
-	ID     *int                   `json:"id,omitempty"`
-	Method string                 `json:"method"`
-	Params map[string]interface{} `json:"params"`
+	ID     *int            `json:"id,omitempty"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"` // decoded per method with protocol.Decode
 }
 
 type Response struct {
@@ -17,3 +23,89 @@ type Response struct {
 	Result bool   `json:"result"`
 	Error  string `json:"error"`
 }
+
+// Config server runtime settings, zero duration disables the related feature
+type Config struct {
+	JobInterval    time.Duration `json:"job_interval"`     // longest time without a new network job, 0 pushes on source changes only
+	JobMinInterval time.Duration `json:"job_min_interval"` // shortest time between jobs pushed on source changes
+	JobDebounce    time.Duration `json:"job_debounce"`     // quiet time after a source change before its job is pushed
+	JobOnChange    bool          `json:"job_on_change"`    // push jobs when the job source signals a change
+	JobOnAuthorize bool          `json:"job_on_authorize"` // send the current job right after a session authorizes
+	ExtranonceSize int           `json:"extranonce_size"`  // bytes of the per-session extranonce, at most 8, 0 gives all sessions the same work
+	IdleTimeout    time.Duration `json:"idle_timeout"`     // close connection when nothing received within
+	PingInterval   time.Duration `json:"ping_interval"`    // ping sessions idle for longer than this
+	AuthTimeout    time.Duration `json:"auth_timeout"`     // reap sessions not authorized within
+	TCPKeepAlive   time.Duration `json:"tcp_keepalive"`    // tcp level keepalive period of accepted conns
+	TLS            *TLSConfig    `json:"tls"`              // nil serves plaintext
+
+	WebSocketOrigins []string `json:"websocket_origins"` // cross origin browsers allowed to connect, "*" for any
+
+	SpoolFile           string        `json:"spool_file"`            // local write-ahead file of shares the db rejected, empty disables
+	SpoolMaxBytes       int64         `json:"spool_max_bytes"`       // shares are dropped once the spool reaches this size
+	SpoolReplayInterval time.Duration `json:"spool_replay_interval"` // retry period of spooled shares
+
+	RejectFlushInterval time.Duration `json:"reject_flush_interval"` // period rejected share counters are written to the db
+
+	RecordDir string `json:"record_dir"` // traffic recordings of usernames enabled with Server.Record, empty disables
+}
+
+func DefaultConfig() Config {
+	return Config{
+		JobInterval:    time.Second * 30,
+		JobMinInterval: time.Second,
+		JobDebounce:    time.Millisecond * 200,
+		JobOnChange:    true,
+		JobOnAuthorize: true,
+		ExtranonceSize: 4,
+		IdleTimeout:    time.Second * 90,
+		PingInterval:   time.Second * 30,
+		AuthTimeout:    time.Second * 10,
+		TCPKeepAlive:   time.Second * 15,
+
+		SpoolMaxBytes:       64 << 20,
+		SpoolReplayInterval: time.Second * 10,
+
+		RejectFlushInterval: time.Second * 10,
+	}
+}
+
+// MarshalJSON durations as strings like "30s", the format of time.ParseDuration
+func (c Config) MarshalJSON() ([]byte, error) {
+	type config Config
+	return json.Marshal(struct {
+		config
+		JobInterval         string `json:"job_interval"`
+		JobMinInterval      string `json:"job_min_interval"`
+		JobDebounce         string `json:"job_debounce"`
+		IdleTimeout         string `json:"idle_timeout"`
+		PingInterval        string `json:"ping_interval"`
+		AuthTimeout         string `json:"auth_timeout"`
+		TCPKeepAlive        string `json:"tcp_keepalive"`
+		SpoolReplayInterval string `json:"spool_replay_interval"`
+		RejectFlushInterval string `json:"reject_flush_interval"`
+	}{
+		config:              config(c),
+		JobInterval:         c.JobInterval.String(),
+		JobMinInterval:      c.JobMinInterval.String(),
+		JobDebounce:         c.JobDebounce.String(),
+		IdleTimeout:         c.IdleTimeout.String(),
+		PingInterval:        c.PingInterval.String(),
+		AuthTimeout:         c.AuthTimeout.String(),
+		TCPKeepAlive:        c.TCPKeepAlive.String(),
+		SpoolReplayInterval: c.SpoolReplayInterval.String(),
+		RejectFlushInterval: c.RejectFlushInterval.String(),
+	})
+}
+
+// SessionInfo session snapshot for operators
+type SessionInfo struct {
+	ID          uint64    `json:"id"`
+	Username    string    `json:"username"`
+	RemoteAddr  string    `json:"remote_addr"`
+	ConnectedAt time.Time `json:"connected_at"`
+	CurrJobID   int       `json:"current_job_id"`
+	Extranonce  string    `json:"extranonce"`
+	LastSubmit  time.Time `json:"last_submit"`
+	Accepted    int64     `json:"accepted"`
+	Rejected    int64     `json:"rejected"`
+}
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+
+	"luxor.tech/tcp_msg_processing_test/pkg/logger"
+	"luxor.tech/tcp_msg_processing_test/pkg/util"
+)
+
+// TLSConfig listener TLS settings
+type TLSConfig struct {
+	CertFile     string             `json:"cert_file"`
+	KeyFile      string             `json:"key_file"`
+	ClientCAFile string             `json:"client_ca_file"` // CA bundle verifying client certificates
+	ClientAuth   tls.ClientAuthType `json:"client_auth"`    // client certificate policy
+	MinVersion   uint16             `json:"min_version"`    // defaults to TLS 1.2
+}
+
+// certReloader serves the latest loaded key pair, swapped on Reload
+type certReloader struct {
+	certFile string
+	keyFile  string
+	cert     atomic.Pointer[tls.Certificate]
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *certReloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load key pair %s: %v", r.certFile, err)
+	}
+	r.cert.Store(&cert)
+	return nil
+}
+
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.cert.Load(), nil
+}
+
+// getTLSConfig build the listener config once, shared by tcp and websocket listeners
+func (s *Server) getTLSConfig() (*tls.Config, error) {
+	s.tlsOnce.Do(func() {
+		s.tls, s.tlsErr = s.buildTLSConfig()
+		if s.tlsErr == nil {
+			go s.watchSIGHUP()
+		}
+	})
+	return s.tls, s.tlsErr
+}
+
+func (s *Server) buildTLSConfig() (*tls.Config, error) {
+	reloader, err := newCertReloader(s.cfg.TLS.CertFile, s.cfg.TLS.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	s.certs = reloader
+
+	tlsConfig := &tls.Config{
+		GetCertificate: reloader.GetCertificate,
+		MinVersion:     s.cfg.TLS.MinVersion,
+		ClientAuth:     s.cfg.TLS.ClientAuth,
+	}
+	if tlsConfig.MinVersion == 0 {
+		tlsConfig.MinVersion = tls.VersionTLS12
+	}
+	if s.cfg.TLS.ClientCAFile != "" {
+		pool, err := util.LoadCertPool(s.cfg.TLS.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.ClientCAs = pool
+	}
+	return tlsConfig, nil
+}
+
+// ReloadTLS reload the certificate files, new handshakes use the new key pair
+func (s *Server) ReloadTLS() error {
+	if s.certs == nil {
+		return fmt.Errorf("tls not enabled")
+	}
+	return s.certs.Reload()
+}
+
+// watchSIGHUP reload certificates on SIGHUP until Close
+func (s *Server) watchSIGHUP() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	defer signal.Stop(ch)
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ch:
+		}
+		if err := s.ReloadTLS(); err != nil {
+			logger.Error("Failed to reload tls certificate:%v", err)
+			continue
+		}
+		logger.Info("TLS certificate reloaded")
+	}
+}
+
+// ParseClientAuth map none|request|require|verify|require-verify to tls.ClientAuthType
+func ParseClientAuth(mode string) (tls.ClientAuthType, error) {
+	switch mode {
+	case "", "none":
+		return tls.NoClientCert, nil
+	case "request":
+		return tls.RequestClientCert, nil
+	case "require":
+		return tls.RequireAnyClientCert, nil
+	case "verify":
+		return tls.VerifyClientCertIfGiven, nil
+	case "require-verify":
+		return tls.RequireAndVerifyClientCert, nil
+	}
+	return tls.NoClientCert, fmt.Errorf("unknown client auth mode: %s", mode)
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"luxor.tech/tcp_msg_processing_test/pkg/logger"
+	"luxor.tech/tcp_msg_processing_test/pkg/wsconn"
+)
+
+const WebSocketPath = "/ws"
+
+// webSocketHandshakeTimeout longest time to read the headers of an upgrade request
+const webSocketHandshakeTimeout = 10 * time.Second
+
+// StartWebSocket listen on addr and serve the websocket protocol until Close
+func (s *Server) StartWebSocket(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		logger.Error("Failed to start websocket:%v", err)
+		return err
+	}
+	return s.ServeWebSocket(listener)
+}
+
+// ServeWebSocket serve the same protocol over websocket on listener until Close, one JSON message per text frame
+func (s *Server) ServeWebSocket(listener net.Listener) error {
+	upgrader := websocket.Upgrader{CheckOrigin: s.checkOrigin}
+	mux := http.NewServeMux()
+	mux.HandleFunc(WebSocketPath, func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			logger.Error("Failed to upgrade websocket:%v", err)
+			return
+		}
+		s.ServeConn(wsconn.New(ws))
+	})
+	httpServer := &http.Server{Handler: mux, ReadHeaderTimeout: webSocketHandshakeTimeout}
+
+	s.mu.Lock()
+	select {
+	case <-s.done:
+		s.mu.Unlock()
+		return listener.Close()
+	default:
+	}
+	s.httpServers = append(s.httpServers, httpServer)
+	s.mu.Unlock()
+
+	logger.Info("WebSocket is listening on port:%v, tls:%v", listener.Addr(), s.cfg.TLS != nil)
+	var err error
+	if s.cfg.TLS != nil {
+		tlsConfig, tlsErr := s.getTLSConfig()
+		if tlsErr != nil {
+			logger.Error("Failed to load tls config:%v", tlsErr)
+			listener.Close()
+			return tlsErr
+		}
+		httpServer.TLSConfig = tlsConfig
+		err = httpServer.ServeTLS(listener, "", "")
+	} else {
+		err = httpServer.Serve(listener)
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// checkOrigin allow same origin requests and the configured browser origins
+func (s *Server) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || slices.Contains(s.cfg.WebSocketOrigins, "*") || slices.Contains(s.cfg.WebSocketOrigins, origin) {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == r.Host
+}
@@ -0,0 +1,113 @@
+// Package servertest run a server.Server in process for tests: an ephemeral port or net.Pipe conns,
+// an in-memory store instead of Postgres, a fake clock, and jobs sent only when the test ticks the job clock.
+package servertest
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"luxor.tech/tcp_msg_processing_test/internal/protocol"
+	"luxor.tech/tcp_msg_processing_test/internal/server"
+	"luxor.tech/tcp_msg_processing_test/pkg/clock"
+)
+
+const waitTimeout = time.Second * 5
+
+// Epoch time of the fake clock when a server starts
+var Epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+type Server struct {
+	*server.Server
+	Addr  string // host:port clients dial
+	Store *MemStore
+	Clock *clock.Fake // rate limits, minute buckets and keepalive only move with Advance
+}
+
+// NewServer start a server with cfg on an ephemeral localhost port, closed with the test.
+// Periodic, change-driven and on-authorize jobs are disabled, call Tick to send jobs.
+func NewServer(t testing.TB, cfg server.Config) *Server {
+	t.Helper()
+	cfg.JobInterval, cfg.JobOnChange, cfg.JobOnAuthorize = 0, false, false
+	return NewServerWithJobs(t, cfg, nil)
+}
+
+// NewServerWithJobs start a server like NewServer but keep the job settings of cfg and serve jobs of source, random
+// when nil. Periodic and debounced jobs follow the fake clock. A source that is a server.ShareHandler gets the
+// accepted shares too
+func NewServerWithJobs(t testing.TB, cfg server.Config, source server.JobSource) *Server {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("servertest: listen: %v", err)
+	}
+
+	s := &Server{
+		Server: server.NewServerWithConfig(cfg),
+		Addr:   ln.Addr().String(),
+		Store:  NewMemStore(),
+		Clock:  clock.NewFake(Epoch),
+	}
+	s.SetStore(s.Store)
+	s.SetClock(s.Clock)
+	if source != nil {
+		s.SetJobSource(source)
+	}
+	if handler, ok := source.(server.ShareHandler); ok {
+		s.SetShareHandler(handler)
+	}
+	go func() {
+		_ = s.Serve(ln)
+	}()
+	t.Cleanup(func() {
+		_ = s.Close()
+	})
+	return s
+}
+
+// Pipe connect a client over net.Pipe, returns the client end
+func (s *Server) Pipe() net.Conn {
+	client, conn := net.Pipe()
+	s.ServeConn(conn)
+	return client
+}
+
+// Tick advance the job clock one interval: every authorized session gets a new job, returns jobs sent
+func (s *Server) Tick() int {
+	return s.BroadcastJob()
+}
+
+// Session snapshot of the first session of username
+func (s *Server) Session(username string) (server.SessionInfo, bool) {
+	for _, info := range s.Sessions() {
+		if info.Username == username {
+			return info, true
+		}
+	}
+	return server.SessionInfo{}, false
+}
+
+// WaitSession wait until username has a session matching cond, fails the test after 5s
+func (s *Server) WaitSession(t testing.TB, username string, cond func(server.SessionInfo) bool) server.SessionInfo {
+	t.Helper()
+	deadline := time.Now().Add(waitTimeout)
+	for {
+		if info, ok := s.Session(username); ok && (cond == nil || cond(info)) {
+			return info
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("servertest: no session of %q matching in %v", username, waitTimeout)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// Job job currently assigned to a session of username
+func (s *Server) Job(t testing.TB, username string) protocol.JobParams {
+	t.Helper()
+	job, ok := s.CurrentJob(username)
+	if !ok {
+		t.Fatalf("servertest: no job sent to %q", username)
+	}
+	return job
+}
@@ -0,0 +1,104 @@
+package servertest
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemStore in-memory server.Store, failures can be injected to exercise the spool
+type MemStore struct {
+	submissions map[string]map[time.Time]int // username -> minute -> accepted
+	rejections  map[string]map[string]int    // username -> reason -> rejected
+	replayed    map[string]bool              // spooled ids applied
+	err         error                        // returned by every call while set
+	mu          sync.Mutex
+}
+
+func NewMemStore() *MemStore {
+	return &MemStore{
+		submissions: make(map[string]map[time.Time]int),
+		rejections:  make(map[string]map[string]int),
+		replayed:    make(map[string]bool),
+	}
+}
+
+// Fail make every following call return err, nil recovers
+func (m *MemStore) Fail(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.err = err
+}
+
+func (m *MemStore) UpsertSubmission(_ context.Context, username string, minute time.Time, count int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return m.err
+	}
+	m.addSubmission(username, minute, count)
+	return nil
+}
+
+func (m *MemStore) ReplaySubmission(_ context.Context, id, username string, minute time.Time, count int) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return false, m.err
+	}
+	if m.replayed[id] {
+		return false, nil
+	}
+	m.replayed[id] = true
+	m.addSubmission(username, minute, count)
+	return true, nil
+}
+
+func (m *MemStore) UpsertRejection(_ context.Context, username string, _ time.Time, reason string, count int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return m.err
+	}
+	if m.rejections[username] == nil {
+		m.rejections[username] = make(map[string]int)
+	}
+	m.rejections[username][reason] += count
+	return nil
+}
+
+func (m *MemStore) addSubmission(username string, minute time.Time, count int) {
+	if m.submissions[username] == nil {
+		m.submissions[username] = make(map[time.Time]int)
+	}
+	m.submissions[username][minute] += count
+}
+
+// Submissions accepted shares stored for username across all minutes
+func (m *MemStore) Submissions(username string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	total := 0
+	for _, count := range m.submissions[username] {
+		total += count
+	}
+	return total
+}
+
+// SubmissionsByMinute accepted shares stored for username per minute bucket
+func (m *MemStore) SubmissionsByMinute(username string) map[time.Time]int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	buckets := make(map[time.Time]int, len(m.submissions[username]))
+	for minute, count := range m.submissions[username] {
+		buckets[minute] = count
+	}
+	return buckets
+}
+
+// Rejections rejected shares flushed for username and reason
+func (m *MemStore) Rejections(username, reason string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.rejections[username][reason]
+}
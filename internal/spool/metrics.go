@@ -0,0 +1,33 @@
+package spool
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	pendingRecords = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "tcpmsg_spool_pending_records",
+		Help: "Records waiting for replay.",
+	})
+	pendingBytes = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "tcpmsg_spool_pending_bytes",
+		Help: "Size of the spool file.",
+	})
+	appendedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "tcpmsg_spool_appended_total",
+		Help: "Records spooled after a failed database write.",
+	})
+	replayedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "tcpmsg_spool_replayed_total",
+		Help: "Records replayed to the database.",
+	})
+	replayErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "tcpmsg_spool_replay_errors_total",
+		Help: "Replay attempts stopped by a failed record.",
+	})
+	droppedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "tcpmsg_spool_dropped_total",
+		Help: "Records lost because the spool was full.",
+	})
+)
@@ -0,0 +1,235 @@
+package spool
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"luxor.tech/tcp_msg_processing_test/pkg/logger"
+)
+
+var (
+	ErrFull   = errors.New("spool is full")
+	ErrClosed = errors.New("spool is closed")
+)
+
+// Record accepted shares of a user minute waiting for the database
+type Record struct {
+	ID       string    `json:"id"` // replay idempotency key
+	Username string    `json:"username"`
+	Minute   time.Time `json:"minute"`
+	Count    int       `json:"count"`
+}
+
+// Spool append-only write-ahead file of records, one JSON object per line
+type Spool struct {
+	path     string
+	maxBytes int64 // 0 is unlimited
+
+	file   *os.File
+	size   int64
+	count  int
+	closed bool
+	mu     sync.Mutex
+}
+
+// Open the spool at path, a torn last line left by a crash is dropped
+func Open(path string, maxBytes int64) (*Spool, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if i := bytes.LastIndexByte(data, '\n'); i+1 != len(data) {
+		logger.Warn("Dropping torn spool tail of %d bytes in %s", len(data)-i-1, path)
+		data = data[:i+1]
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			return nil, err
+		}
+	}
+
+	s := &Spool{path: path, maxBytes: maxBytes, size: int64(len(data)), count: bytes.Count(data, []byte{'\n'})}
+	if s.file, err = os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644); err != nil {
+		return nil, err
+	}
+	s.updateGauges()
+	return s, nil
+}
+
+func NewRecord(username string, minute time.Time, count int) Record {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	return Record{ID: hex.EncodeToString(id), Username: username, Minute: minute, Count: count}
+}
+
+// Append persist rec durably, ErrFull when it would exceed the size limit
+func (s *Spool) Append(rec Record) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+	if s.maxBytes > 0 && s.size+int64(len(line)) > s.maxBytes {
+		droppedTotal.Inc()
+		return ErrFull
+	}
+	if _, err := s.file.Write(line); err != nil {
+		return err
+	}
+	if err := s.file.Sync(); err != nil {
+		return err
+	}
+	s.size += int64(len(line))
+	s.count++
+	appendedTotal.Inc()
+	s.updateGauges()
+	return nil
+}
+
+// Len records waiting for replay
+func (s *Spool) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.count
+}
+
+// Replay feed records to apply in order until one fails, replayed records are removed.
+// Appends are not blocked while apply runs.
+func (s *Spool) Replay(apply func(Record) error) (int, error) {
+	s.mu.Lock()
+	snapshot, closed := s.size, s.closed
+	s.mu.Unlock()
+	if closed {
+		return 0, ErrClosed
+	}
+	if snapshot == 0 {
+		return 0, nil
+	}
+
+	records, err := s.read(0, snapshot)
+	if err != nil {
+		return 0, err
+	}
+	replayed := 0
+	var applyErr error
+	for _, rec := range records {
+		if applyErr = apply(rec); applyErr != nil {
+			replayErrors.Inc()
+			break
+		}
+		replayed++
+	}
+	replayedTotal.Add(float64(replayed))
+	if replayed == 0 {
+		return 0, applyErr
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		// the replayed records stay in the file, replaying them again is idempotent through their ids
+		return replayed, ErrClosed
+	}
+	// keep the unreplayed records plus whatever was appended meanwhile
+	var buf bytes.Buffer
+	for _, rec := range records[replayed:] {
+		line, _ := json.Marshal(rec)
+		buf.Write(append(line, '\n'))
+	}
+	tail, err := s.readRaw(snapshot, s.size)
+	if err != nil {
+		return replayed, err
+	}
+	buf.Write(tail)
+	if err := s.rewrite(buf.Bytes()); err != nil {
+		return replayed, err
+	}
+	return replayed, applyErr
+}
+
+// Close the spool file, later appends and replays fail with ErrClosed
+func (s *Spool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	return s.file.Close()
+}
+
+func (s *Spool) read(from, to int64) ([]Record, error) {
+	data, err := s.readRaw(from, to)
+	if err != nil {
+		return nil, err
+	}
+	var records []Record
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		var rec Record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("corrupt spool record %q: %v", scanner.Text(), err)
+		}
+		records = append(records, rec)
+	}
+	return records, scanner.Err()
+}
+
+func (s *Spool) readRaw(from, to int64) ([]byte, error) {
+	file, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	data := make([]byte, to-from)
+	_, err = io.ReadFull(io.NewSectionReader(file, from, to-from), data)
+	return data, err
+}
+
+// rewrite atomically replace the spool content, caller holds mu
+func (s *Spool) rewrite(data []byte) error {
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	file, err := os.Open(tmp)
+	if err == nil {
+		err = file.Sync()
+		file.Close()
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return err
+	}
+	s.file.Close()
+	if s.file, err = os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644); err != nil {
+		return err
+	}
+	s.size, s.count = int64(len(data)), bytes.Count(data, []byte{'\n'})
+	s.updateGauges()
+	return nil
+}
+
+func (s *Spool) updateGauges() {
+	pendingRecords.Set(float64(s.count))
+	pendingBytes.Set(float64(s.size))
+}
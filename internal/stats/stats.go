@@ -0,0 +1,236 @@
+package stats
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	rds_db "luxor.tech/tcp_msg_processing_test/rds-db"
+)
+
+type Granularity string
+
+const (
+	Minute Granularity = "minute"
+	Hour   Granularity = "hour"
+	Day    Granularity = "day"
+)
+
+func ParseGranularity(s string) (Granularity, error) {
+	switch g := Granularity(s); g {
+	case Minute, Hour, Day:
+		return g, nil
+	case "":
+		return Hour, nil
+	}
+	return "", fmt.Errorf("unknown granularity: %s", s)
+}
+
+// ParseWindow parse RFC3339 bounds of [from, to), defaults to the last 24 hours before now
+func ParseWindow(from, to string, now time.Time) (time.Time, time.Time, error) {
+	end := now.UTC()
+	if to != "" {
+		t, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid to: %v", err)
+		}
+		end = t.UTC()
+	}
+	start := end.Add(-time.Hour * 24)
+	if from != "" {
+		t, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid from: %v", err)
+		}
+		start = t.UTC()
+	}
+	if !start.Before(end) {
+		return time.Time{}, time.Time{}, fmt.Errorf("from must be before to")
+	}
+	return start, end, nil
+}
+
+type Point struct {
+	Time  time.Time `json:"time"`
+	Count int64     `json:"count"`
+}
+
+type UserTotal struct {
+	Username string `json:"username"`
+	Count    int64  `json:"count"`
+}
+
+type Totals struct {
+	From        time.Time `json:"from"`
+	To          time.Time `json:"to"`
+	Users       int64     `json:"users"`
+	Submissions int64     `json:"submissions"`
+}
+
+// UserQuality accepted and rejected shares of a user, rejected ones split by reason
+type UserQuality struct {
+	Username        string           `json:"username"`
+	Accepted        int64            `json:"accepted"`
+	Rejected        int64            `json:"rejected"`
+	Reasons         map[string]int64 `json:"reasons"`
+	AcceptanceRatio float64          `json:"acceptance_ratio"`
+}
+
+// AcceptanceRatio share of accepted among all submitted, 0 when nothing was submitted
+func AcceptanceRatio(accepted, rejected int64) float64 {
+	if accepted+rejected <= 0 {
+		return 0
+	}
+	return float64(accepted) / float64(accepted+rejected)
+}
+
+// Service read queries over the submission_counts view, minute rows until rolled up and pruned,
+// then hourly and daily rows: old windows are only as precise as the rollup retained
+type Service struct {
+	db *sql.DB
+}
+
+func NewService(db *sql.DB) *Service {
+	return &Service{db: db}
+}
+
+// UserSeries submissions of username in [from, to) bucketed by granularity
+func (s *Service) UserSeries(ctx context.Context, username string, from, to time.Time, granularity Granularity) ([]Point, error) {
+	ctx, cancel := rds_db.QueryContext(ctx)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT date_trunc($1, timestamp) AS bucket, SUM(submission_count)
+		FROM submission_counts
+		WHERE username = $2 AND timestamp >= $3 AND timestamp < $4
+		GROUP BY bucket
+		ORDER BY bucket`, string(granularity), username, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	points := make([]Point, 0)
+	for rows.Next() {
+		var p Point
+		if err := rows.Scan(&p.Time, &p.Count); err != nil {
+			return nil, err
+		}
+		p.Time = p.Time.UTC()
+		points = append(points, p)
+	}
+	return points, rows.Err()
+}
+
+// TopUsers the n users with most submissions in [from, to)
+func (s *Service) TopUsers(ctx context.Context, from, to time.Time, n int) ([]UserTotal, error) {
+	ctx, cancel := rds_db.QueryContext(ctx)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT username, SUM(submission_count) AS total
+		FROM submission_counts
+		WHERE timestamp >= $1 AND timestamp < $2
+		GROUP BY username
+		ORDER BY total DESC, username
+		LIMIT $3`, from, to, n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := make([]UserTotal, 0, n)
+	for rows.Next() {
+		var u UserTotal
+		if err := rows.Scan(&u.Username, &u.Count); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// Totals distinct users and submissions in [from, to)
+func (s *Service) Totals(ctx context.Context, from, to time.Time) (Totals, error) {
+	ctx, cancel := rds_db.QueryContext(ctx)
+	defer cancel()
+	totals := Totals{From: from, To: to}
+	err := s.db.QueryRowContext(ctx, `
+		SELECT COUNT(DISTINCT username), COALESCE(SUM(submission_count), 0)
+		FROM submission_counts
+		WHERE timestamp >= $1 AND timestamp < $2`, from, to).Scan(&totals.Users, &totals.Submissions)
+	return totals, err
+}
+
+// Rejections accepted and rejected shares per user in [from, to), all users when username is empty,
+// users with most rejections first
+func (s *Service) Rejections(ctx context.Context, username string, from, to time.Time) ([]UserQuality, error) {
+	ctx, cancel := rds_db.QueryContext(ctx)
+	defer cancel()
+	users := make(map[string]*UserQuality)
+	user := func(name string) *UserQuality {
+		u, exist := users[name]
+		if !exist {
+			u = &UserQuality{Username: name, Reasons: make(map[string]int64)}
+			users[name] = u
+		}
+		return u
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT username, reason, SUM(rejected_count)
+		FROM rejected_submissions
+		WHERE timestamp >= $1 AND timestamp < $2 AND ($3 = '' OR username = $3)
+		GROUP BY username, reason`, from, to, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name, reason string
+		var count int64
+		if err := rows.Scan(&name, &reason, &count); err != nil {
+			return nil, err
+		}
+		u := user(name)
+		u.Reasons[reason] += count
+		u.Rejected += count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = s.db.QueryContext(ctx, `
+		SELECT username, SUM(submission_count)
+		FROM submission_counts
+		WHERE timestamp >= $1 AND timestamp < $2 AND ($3 = '' OR username = $3)
+		GROUP BY username`, from, to, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		var count int64
+		if err := rows.Scan(&name, &count); err != nil {
+			return nil, err
+		}
+		user(name).Accepted = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	result := make([]UserQuality, 0, len(users))
+	for _, u := range users {
+		u.AcceptanceRatio = AcceptanceRatio(u.Accepted, u.Rejected)
+		result = append(result, *u)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Rejected != result[j].Rejected {
+			return result[i].Rejected > result[j].Rejected
+		}
+		return result[i].Username < result[j].Username
+	})
+	return result, nil
+}
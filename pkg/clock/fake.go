@@ -0,0 +1,201 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Fake a clock moved only by Advance and Set. Tickers fire at most once per Advance and drop
+// missed ticks like time.Ticker; Sleep, After and timers return once the clock reaches their deadline.
+type Fake struct {
+	now     time.Time
+	tickers []*fakeTicker
+	timers  []*fakeTimer // armed timers
+	waiters []waiter
+	waits   int // waits started so far
+	mu      sync.Mutex
+}
+
+type waiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now}
+}
+
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+func (f *Fake) Since(t time.Time) time.Duration {
+	return f.Now().Sub(t)
+}
+
+func (f *Fake) Sleep(d time.Duration) {
+	<-f.After(d)
+}
+
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- f.now
+		return ch
+	}
+	f.waiters = append(f.waiters, waiter{at: f.now.Add(d), ch: ch})
+	f.waits++
+	return ch
+}
+
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	t := &fakeTicker{fake: f, period: d, next: f.now.Add(d), ch: make(chan time.Time, 1)}
+	f.tickers = append(f.tickers, t)
+	return t
+}
+
+// Advance move the clock forward by d, firing due tickers and waking due sleepers
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = f.now.Add(d)
+
+	for _, t := range f.tickers {
+		if t.next.After(f.now) {
+			continue
+		}
+		select {
+		case t.ch <- f.now:
+		default: // receiver behind, drop like time.Ticker
+		}
+		for !t.next.After(f.now) {
+			t.next = t.next.Add(t.period)
+		}
+	}
+
+	armed := f.timers[:0]
+	for _, t := range f.timers {
+		if t.at.After(f.now) {
+			armed = append(armed, t)
+			continue
+		}
+		t.ch <- f.now
+	}
+	f.timers = armed
+
+	pending := f.waiters[:0]
+	for _, w := range f.waiters {
+		if w.at.After(f.now) {
+			pending = append(pending, w)
+			continue
+		}
+		w.ch <- f.now
+	}
+	f.waiters = pending
+}
+
+// Set move the clock to now, never backwards
+func (f *Fake) Set(now time.Time) {
+	if d := now.Sub(f.Now()); d > 0 {
+		f.Advance(d)
+	}
+}
+
+// Waiters sleepers, After calls and armed timers not yet due, lets tests advance only once a goroutine blocks
+func (f *Fake) Waiters() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.waiters) + len(f.timers)
+}
+
+// Waits sleeps, After calls and timer resets so far, lets tests see a goroutine rearm a timer it already had
+func (f *Fake) Waits() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.waits
+}
+
+// NewTimer a timer firing once the clock reaches d from now
+func (f *Fake) NewTimer(d time.Duration) Timer {
+	t := &fakeTimer{fake: f, ch: make(chan time.Time, 1)}
+	t.Reset(d)
+	return t
+}
+
+type fakeTicker struct {
+	fake   *Fake
+	period time.Duration
+	next   time.Time
+	ch     chan time.Time
+}
+
+func (t *fakeTicker) C() <-chan time.Time {
+	return t.ch
+}
+
+func (t *fakeTicker) Stop() {
+	f := t.fake
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, other := range f.tickers {
+		if other == t {
+			f.tickers = append(f.tickers[:i], f.tickers[i+1:]...)
+			return
+		}
+	}
+}
+
+type fakeTimer struct {
+	fake *Fake
+	at   time.Time
+	ch   chan time.Time
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.ch
+}
+
+// Reset rearm the timer, an unreceived fire is dropped like time.Timer does since Go 1.23
+func (t *fakeTimer) Reset(d time.Duration) {
+	f := t.fake
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	t.stop()
+	f.waits++
+	if d <= 0 {
+		t.ch <- f.now
+		return
+	}
+	t.at = f.now.Add(d)
+	f.timers = append(f.timers, t)
+}
+
+func (t *fakeTimer) Stop() {
+	t.fake.mu.Lock()
+	defer t.fake.mu.Unlock()
+	t.stop()
+}
+
+// stop disarm the timer and drop its unreceived fire, fake.mu must be held
+func (t *fakeTimer) stop() {
+	f := t.fake
+	for i, other := range f.timers {
+		if other == t {
+			f.timers = append(f.timers[:i], f.timers[i+1:]...)
+			break
+		}
+	}
+	select {
+	case <-t.ch:
+	default:
+	}
+}
@@ -0,0 +1,159 @@
+package logger
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+)
+
+// runtime overrides, shared by every logger
+var (
+	levelOverride atomic.Pointer[slog.Level] // nil keeps the configured sink levels
+	baseLevel     atomic.Int64               // configured log_level of the global logger
+
+	debugTargets   = make(map[string]map[string]bool) // field key -> values logged at debug
+	debugTargetsN  atomic.Int32
+	debugTargetsMu sync.RWMutex
+)
+
+var levelCycle = []slog.Level{slog.LevelDebug, slog.LevelInfo, slog.LevelWarn, slog.LevelError}
+
+// sinkLevel configured level of a sink, replaced by SetLevel at runtime
+type sinkLevel slog.Level
+
+func (l sinkLevel) Level() slog.Level {
+	if override := levelOverride.Load(); override != nil {
+		return *override
+	}
+	return slog.Level(l)
+}
+
+// SetLevel override the level of every sink until ResetLevel
+func SetLevel(level slog.Level) {
+	levelOverride.Store(&level)
+	Warn("Log level set to %v", level)
+}
+
+// ResetLevel restore the configured sink levels
+func ResetLevel() {
+	levelOverride.Store(nil)
+	Warn("Log level reset to configured %v", GetLevel())
+}
+
+// GetLevel the runtime override or the configured log_level
+func GetLevel() slog.Level {
+	if override := levelOverride.Load(); override != nil {
+		return *override
+	}
+	return slog.Level(baseLevel.Load())
+}
+
+// HandleLevelSignals SIGUSR1 makes logging more verbose, SIGUSR2 less verbose
+func HandleLevelSignals() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGUSR1, syscall.SIGUSR2)
+	for sig := range ch {
+		current := GetLevel()
+		idx := 0
+		for i, level := range levelCycle {
+			if level <= current {
+				idx = i
+			}
+		}
+		if sig == syscall.SIGUSR1 && idx > 0 {
+			idx--
+		} else if sig == syscall.SIGUSR2 && idx < len(levelCycle)-1 {
+			idx++
+		}
+		SetLevel(levelCycle[idx])
+	}
+}
+
+// EnableDebugFor log debug records carrying field key=value, e.g. ("username", "alice") or ("session_id", "12")
+func EnableDebugFor(key, value string) {
+	debugTargetsMu.Lock()
+	defer debugTargetsMu.Unlock()
+	if debugTargets[key] == nil {
+		debugTargets[key] = make(map[string]bool)
+	}
+	if !debugTargets[key][value] {
+		debugTargets[key][value] = true
+		debugTargetsN.Add(1)
+	}
+}
+
+func DisableDebugFor(key, value string) {
+	debugTargetsMu.Lock()
+	defer debugTargetsMu.Unlock()
+	if debugTargets[key][value] {
+		delete(debugTargets[key], value)
+		debugTargetsN.Add(-1)
+	}
+}
+
+// DebugTargets field key -> values currently logged at debug
+func DebugTargets() map[string][]string {
+	debugTargetsMu.RLock()
+	defer debugTargetsMu.RUnlock()
+	targets := make(map[string][]string, len(debugTargets))
+	for key, values := range debugTargets {
+		for value := range values {
+			targets[key] = append(targets[key], value)
+		}
+	}
+	return targets
+}
+
+func isDebugTarget(attr slog.Attr) bool {
+	debugTargetsMu.RLock()
+	defer debugTargetsMu.RUnlock()
+	return debugTargets[attr.Key][attr.Value.String()]
+}
+
+type forcedKey struct{}
+
+// isForced record selected by a debug target, sinks must not filter it by level
+func isForced(ctx context.Context) bool {
+	forced, _ := ctx.Value(forcedKey{}).(bool)
+	return forced
+}
+
+// targetHandler let debug records of targeted usernames/sessions through the sink levels
+type targetHandler struct {
+	inner slog.Handler
+	attrs []slog.Attr // accumulated by With
+}
+
+func (h *targetHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.inner.Enabled(ctx, level) || (level >= slog.LevelDebug && debugTargetsN.Load() > 0)
+}
+
+func (h *targetHandler) Handle(ctx context.Context, r slog.Record) error {
+	if h.inner.Enabled(ctx, r.Level) {
+		return h.inner.Handle(ctx, r)
+	}
+	matched := false
+	for _, attr := range h.attrs {
+		matched = matched || isDebugTarget(attr)
+	}
+	r.Attrs(func(attr slog.Attr) bool {
+		matched = matched || isDebugTarget(attr)
+		return !matched
+	})
+	if !matched {
+		return nil
+	}
+	return h.inner.Handle(context.WithValue(ctx, forcedKey{}, true), r)
+}
+
+func (h *targetHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &targetHandler{inner: h.inner.WithAttrs(attrs), attrs: append(h.attrs[:len(h.attrs):len(h.attrs)], attrs...)}
+}
+
+func (h *targetHandler) WithGroup(name string) slog.Handler {
+	return &targetHandler{inner: h.inner.WithGroup(name), attrs: h.attrs}
+}
@@ -1,27 +1,39 @@
 package logger
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"os"
+	"strings"
+	"sync/atomic"
+	"time"
 )
 
 type Config struct {
 	LogFile       string `json:"log_file"`
-	LogLevel      string `json:"log_level"`
-	LogFormat     string `json:"log_format"`
-	LogTimeFormat string `json:"log_time_format"`
+	LogLevel      string `json:"log_level"`       // debug|info|warn|error
+	LogFormat     string `json:"log_format"`      // text|json
+	LogTimeFormat string `json:"log_time_format"` // go time layout, RFC3339 when empty
+
+	Sinks []SinkConfig `json:"sinks"` // fan-out destinations, log_file is used when empty
 }
 
+// Logger printf style leveled logger carrying structured fields
 type Logger struct {
-	logger *log.Logger
-	level  string
+	slog    *slog.Logger
+	closers []io.Closer // sinks owned by the logger
 }
 
-// Global logger instance
-var logger *Logger
+// Global logger instance, stdout at info level until InitLogger
+var logger atomic.Pointer[Logger]
+
+func init() {
+	l, _ := NewLogger(os.Stdout, Config{})
+	logger.Store(l)
+}
 
 // InitLogger initializes the logger based on the configuration file
 func InitLogger(configFile string) error {
@@ -38,36 +50,169 @@ func InitLogger(configFile string) error {
 		return err
 	}
 
-	// Set output destination
-	var output io.Writer
-	if config.LogFile == "" {
-		output = os.Stdout
-	} else {
-		outputFile, err := os.OpenFile(config.LogFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+	l, err := openLogger(config)
+	if err != nil {
+		return err
+	}
+	level, _ := ParseLevel(config.LogLevel)
+	baseLevel.Store(int64(level))
+	if prev := logger.Swap(l); prev != nil {
+		prev.Close()
+	}
+	return nil
+}
+
+func openLogger(config Config) (*Logger, error) {
+	if len(config.Sinks) == 0 {
+		// Set output destination
+		var output io.Writer
+		if config.LogFile == "" {
+			output = os.Stdout
+		} else {
+			outputFile, err := os.OpenFile(config.LogFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+			if err != nil {
+				return nil, err
+			}
+			output = outputFile
+		}
+		l, err := NewLogger(output, config)
+		if err != nil {
+			return nil, err
+		}
+		if closer, ok := output.(io.Closer); ok && output != os.Stdout {
+			l.closers = append(l.closers, closer)
+		}
+		return l, nil
+	}
+
+	l := &Logger{}
+	handlers := make(fanoutHandler, 0, len(config.Sinks))
+	for _, sink := range config.Sinks {
+		handler, closer, err := openSink(sink, config)
+		if closer != nil {
+			l.closers = append(l.closers, closer)
+		}
 		if err != nil {
-			return err
+			l.Close()
+			return nil, fmt.Errorf("log sink %s: %v", sink.Type, err)
 		}
-		output = outputFile
+		handlers = append(handlers, handler)
 	}
+	l.slog = slog.New(&targetHandler{inner: handlers})
+	return l, nil
+}
 
-	logger = &Logger{
-		logger: log.New(output, "", log.LstdFlags),
-		level:  config.LogLevel,
+// SetDefault replace the global logger, e.g. by command line tools logging to stderr
+func SetDefault(l *Logger) {
+	if prev := logger.Swap(l); prev != nil {
+		prev.Close()
 	}
+}
+
+// Close release the sinks of the global logger
+func Close() {
+	logger.Load().Close()
+}
 
-	if config.LogTimeFormat != "" {
-		log.SetFlags(0)
-		logger.logger.SetFlags(0)
-		logger.logger.SetPrefix("")
-		logger.logger.SetOutput(log.Writer())
+func (l *Logger) Close() {
+	for _, closer := range l.closers {
+		_ = closer.Close()
 	}
+}
 
-	return nil
+// NewLogger build a logger writing to output with the level, format and time layout of config
+func NewLogger(output io.Writer, config Config) (*Logger, error) {
+	level, err := ParseLevel(config.LogLevel)
+	if err != nil {
+		return nil, err
+	}
+	handler, err := newHandler(output, config.LogFormat, level, config.LogTimeFormat)
+	if err != nil {
+		return nil, err
+	}
+	return &Logger{slog: slog.New(&targetHandler{inner: handler})}, nil
+}
+
+func newHandler(output io.Writer, format string, level slog.Level, timeFormat string) (slog.Handler, error) {
+	if timeFormat == "" {
+		timeFormat = time.RFC3339
+	}
+	opts := &slog.HandlerOptions{
+		Level: sinkLevel(level),
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey && len(groups) == 0 {
+				a.Value = slog.StringValue(a.Value.Time().Format(timeFormat))
+			}
+			return a
+		},
+	}
+
+	switch strings.ToLower(format) {
+	case "", "text":
+		return slog.NewTextHandler(output, opts), nil
+	case "json":
+		return slog.NewJSONHandler(output, opts), nil
+	}
+	return nil, fmt.Errorf("unknown log format: %s", format)
+}
+
+// ParseLevel map debug|info|warn|error to slog.Level, empty means info
+func ParseLevel(level string) (slog.Level, error) {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return slog.LevelInfo, fmt.Errorf("unknown log level: %s", level)
 }
 
-func Info(str string, v ...interface{}) {
-	logger.logger.Println("[INFO]", fmt.Sprintf(str, v...))
+// With child logger attaching key/value pairs to every record, e.g. With("session_id", id, "username", name)
+func (l *Logger) With(kv ...interface{}) *Logger {
+	return &Logger{slog: l.slog.With(kv...)}
 }
-func Error(str string, v ...interface{}) {
-	logger.logger.Println("[ERROR]", fmt.Sprintf(str, v...))
+
+func (l *Logger) Debug(str string, v ...interface{}) { l.log(slog.LevelDebug, str, v...) }
+func (l *Logger) Info(str string, v ...interface{})  { l.log(slog.LevelInfo, str, v...) }
+func (l *Logger) Warn(str string, v ...interface{})  { l.log(slog.LevelWarn, str, v...) }
+func (l *Logger) Error(str string, v ...interface{}) { l.log(slog.LevelError, str, v...) }
+
+// Debugw, Infow, Warnw and Errorw log msg with per-call key/value fields
+func (l *Logger) Debugw(msg string, kv ...interface{}) {
+	l.slog.Log(context.Background(), slog.LevelDebug, msg, kv...)
+}
+func (l *Logger) Infow(msg string, kv ...interface{}) {
+	l.slog.Log(context.Background(), slog.LevelInfo, msg, kv...)
+}
+func (l *Logger) Warnw(msg string, kv ...interface{}) {
+	l.slog.Log(context.Background(), slog.LevelWarn, msg, kv...)
+}
+func (l *Logger) Errorw(msg string, kv ...interface{}) {
+	l.slog.Log(context.Background(), slog.LevelError, msg, kv...)
+}
+
+func (l *Logger) log(level slog.Level, str string, v ...interface{}) {
+	ctx := context.Background()
+	if !l.slog.Enabled(ctx, level) {
+		return // skip formatting of filtered records
+	}
+	l.slog.Log(ctx, level, fmt.Sprintf(str, v...))
+}
+
+func With(kv ...interface{}) *Logger {
+	return logger.Load().With(kv...)
 }
+
+func Debug(str string, v ...interface{}) { logger.Load().Debug(str, v...) }
+func Info(str string, v ...interface{})  { logger.Load().Info(str, v...) }
+func Warn(str string, v ...interface{})  { logger.Load().Warn(str, v...) }
+func Error(str string, v ...interface{}) { logger.Load().Error(str, v...) }
+
+func Debugw(msg string, kv ...interface{}) { logger.Load().Debugw(msg, kv...) }
+func Infow(msg string, kv ...interface{})  { logger.Load().Infow(msg, kv...) }
+func Warnw(msg string, kv ...interface{})  { logger.Load().Warnw(msg, kv...) }
+func Errorw(msg string, kv ...interface{}) { logger.Load().Errorw(msg, kv...) }
@@ -0,0 +1,156 @@
+package logger
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const backupTimeFormat = "20060102T150405.000"
+
+// RotatingFile append only log file rotated by size and/or time,
+// backups are named <path>.<timestamp>[.gz]
+type RotatingFile struct {
+	Path       string
+	MaxSize    int64         // bytes, 0 disables size based rotation
+	Interval   time.Duration // rotate on interval boundaries, 0 disables time based rotation
+	MaxBackups int           // backups kept, 0 keeps all
+	MaxAge     time.Duration // backups older than this are removed, 0 keeps all
+	Compress   bool          // gzip backups
+
+	file     *os.File
+	size     int64
+	openedAt time.Time
+	mu       sync.Mutex
+	cleanMu  sync.Mutex
+}
+
+func (r *RotatingFile) Open() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.open()
+}
+
+func (r *RotatingFile) open() error {
+	file, err := os.OpenFile(r.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	r.file, r.size, r.openedAt = file, info.Size(), time.Now()
+	return nil
+}
+
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+	}
+	if r.shouldRotate(int64(len(p)), time.Now()) {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
+
+func (r *RotatingFile) shouldRotate(n int64, now time.Time) bool {
+	if r.MaxSize > 0 && r.size > 0 && r.size+n > r.MaxSize {
+		return true
+	}
+	return r.Interval > 0 && !now.Truncate(r.Interval).Equal(r.openedAt.Truncate(r.Interval))
+}
+
+func (r *RotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+	backup := r.Path + "." + time.Now().Format(backupTimeFormat)
+	if err := os.Rename(r.Path, backup); err != nil {
+		return err
+	}
+	if err := r.open(); err != nil {
+		return err
+	}
+	go r.cleanup(backup)
+	return nil
+}
+
+// cleanup compress the fresh backup and apply retention
+func (r *RotatingFile) cleanup(backup string) {
+	r.cleanMu.Lock()
+	defer r.cleanMu.Unlock()
+
+	if r.Compress {
+		if err := gzipFile(backup); err != nil {
+			Error("Failed to compress log backup %s: %v", backup, err)
+		}
+	}
+
+	backups, _ := filepath.Glob(r.Path + ".*")
+	sort.Strings(backups) // timestamp suffix sorts oldest first
+	now := time.Now()
+	for i, name := range backups {
+		expired := r.MaxBackups > 0 && i < len(backups)-r.MaxBackups
+		if !expired && r.MaxAge > 0 {
+			if info, err := os.Stat(name); err == nil && now.Sub(info.ModTime()) > r.MaxAge {
+				expired = true
+			}
+		}
+		if expired {
+			_ = os.Remove(name)
+		}
+	}
+}
+
+func gzipFile(name string) error {
+	if strings.HasSuffix(name, ".gz") {
+		return nil
+	}
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(name+".gz", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0666)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	if _, err = io.Copy(zw, src); err == nil {
+		err = zw.Close()
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(name + ".gz")
+		return err
+	}
+	return os.Remove(name)
+}
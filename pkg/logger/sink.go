@@ -0,0 +1,134 @@
+package logger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// SinkConfig one log destination with its own level and format
+type SinkConfig struct {
+	Type   string `json:"type"`   // stdout|file|syslog
+	Level  string `json:"level"`  // defaults to log_level
+	Format string `json:"format"` // defaults to log_format
+
+	// file
+	Path        string   `json:"path"`
+	MaxSizeMB   int64    `json:"max_size_mb"`
+	RotateEvery Duration `json:"rotate_every"`
+	MaxBackups  int      `json:"max_backups"`
+	MaxAge      Duration `json:"max_age"`
+	Compress    bool     `json:"compress"`
+
+	// syslog over udp
+	Addr     string `json:"addr"`
+	Tag      string `json:"tag"`
+	Facility int    `json:"facility"` // defaults to local0
+}
+
+// Duration time.Duration decoded from strings like "24h"
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// openSink build the handler of sink, closer is nil for stdout
+func openSink(sink SinkConfig, config Config) (slog.Handler, io.Closer, error) {
+	if sink.Level == "" {
+		sink.Level = config.LogLevel
+	}
+	if sink.Format == "" {
+		sink.Format = config.LogFormat
+	}
+	level, err := ParseLevel(sink.Level)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch sink.Type {
+	case "stdout":
+		handler, err := newHandler(os.Stdout, sink.Format, level, config.LogTimeFormat)
+		return handler, nil, err
+	case "file":
+		file := &RotatingFile{
+			Path:       sink.Path,
+			MaxSize:    sink.MaxSizeMB << 20,
+			Interval:   time.Duration(sink.RotateEvery),
+			MaxBackups: sink.MaxBackups,
+			MaxAge:     time.Duration(sink.MaxAge),
+			Compress:   sink.Compress,
+		}
+		if err := file.Open(); err != nil {
+			return nil, nil, err
+		}
+		handler, err := newHandler(file, sink.Format, level, config.LogTimeFormat)
+		return handler, file, err
+	case "syslog":
+		w, err := dialSyslog(sink.Addr, sink.Tag, sink.Facility)
+		if err != nil {
+			return nil, nil, err
+		}
+		inner, err := newHandler(w, sink.Format, level, config.LogTimeFormat)
+		return &syslogHandler{inner: inner, w: w}, w, err
+	}
+	return nil, nil, fmt.Errorf("unknown log sink type: %s", sink.Type)
+}
+
+// fanoutHandler dispatch records to every sink accepting the level
+type fanoutHandler []slog.Handler
+
+func (f fanoutHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range f {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f fanoutHandler) Handle(ctx context.Context, r slog.Record) error {
+	var firstErr error
+	for _, h := range f {
+		if !h.Enabled(ctx, r.Level) && !isForced(ctx) {
+			continue
+		}
+		if err := h.Handle(ctx, r.Clone()); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (f fanoutHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make(fanoutHandler, len(f))
+	for i, h := range f {
+		handlers[i] = h.WithAttrs(attrs)
+	}
+	return handlers
+}
+
+func (f fanoutHandler) WithGroup(name string) slog.Handler {
+	handlers := make(fanoutHandler, len(f))
+	for i, h := range f {
+		handlers[i] = h.WithGroup(name)
+	}
+	return handlers
+}
@@ -0,0 +1,89 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const facilityLocal0 = 16
+
+// syslogWriter send every written record as one RFC 3164 datagram
+type syslogWriter struct {
+	conn     net.Conn
+	tag      string
+	hostname string
+	facility int
+	severity int // of the record being written, guarded by mu
+	mu       sync.Mutex
+}
+
+func dialSyslog(addr, tag string, facility int) (*syslogWriter, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	hostname, _ := os.Hostname()
+	if tag == "" {
+		tag = "tcp_msg"
+	}
+	if facility == 0 {
+		facility = facilityLocal0
+	}
+	return &syslogWriter{conn: conn, tag: tag, hostname: hostname, facility: facility}, nil
+}
+
+func (w *syslogWriter) Write(p []byte) (int, error) {
+	msg := fmt.Sprintf("<%d>%s %s %s[%d]: %s", w.facility*8+w.severity, time.Now().Format(time.Stamp),
+		w.hostname, w.tag, os.Getpid(), strings.TrimRight(string(p), "\n"))
+	if _, err := w.conn.Write([]byte(msg)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w *syslogWriter) Close() error {
+	return w.conn.Close()
+}
+
+func syslogSeverity(level slog.Level) int {
+	switch {
+	case level >= slog.LevelError:
+		return 3
+	case level >= slog.LevelWarn:
+		return 4
+	case level >= slog.LevelInfo:
+		return 6
+	}
+	return 7
+}
+
+// syslogHandler format records with inner and tag the datagram with the record severity
+type syslogHandler struct {
+	inner slog.Handler
+	w     *syslogWriter
+}
+
+func (h *syslogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.inner.Enabled(ctx, level)
+}
+
+func (h *syslogHandler) Handle(ctx context.Context, r slog.Record) error {
+	h.w.mu.Lock()
+	defer h.w.mu.Unlock()
+	h.w.severity = syslogSeverity(r.Level)
+	return h.inner.Handle(ctx, r)
+}
+
+func (h *syslogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &syslogHandler{inner: h.inner.WithAttrs(attrs), w: h.w}
+}
+
+func (h *syslogHandler) WithGroup(name string) slog.Handler {
+	return &syslogHandler{inner: h.inner.WithGroup(name), w: h.w}
+}
@@ -0,0 +1,19 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"luxor.tech/tcp_msg_processing_test/pkg/logger"
+)
+
+const Path = "/metrics"
+
+// Serve expose the default prometheus registry on addr
+func Serve(addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle(Path, promhttp.Handler())
+	logger.Info("Metrics is listening on port:%v", addr)
+	return http.ListenAndServe(addr, mux)
+}
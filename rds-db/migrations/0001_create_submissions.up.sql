@@ -0,0 +1,8 @@
+-- baseline of db/schema.sql, safe on databases initialized by it
+CREATE TABLE IF NOT EXISTS submissions (
+             username VARCHAR(255) NOT NULL,
+             timestamp TIMESTAMP NOT NULL,
+             submission_count INT NOT NULL,
+             CONSTRAINT unique_user_time UNIQUE (username, timestamp)
+);
+CREATE INDEX IF NOT EXISTS idx_user_time ON submissions (username, timestamp);
@@ -0,0 +1,5 @@
+-- ids of spooled submissions already replayed, makes replays idempotent
+CREATE TABLE IF NOT EXISTS spool_replays (
+             id VARCHAR(64) PRIMARY KEY,
+             replayed_at TIMESTAMP NOT NULL DEFAULT now()
+);
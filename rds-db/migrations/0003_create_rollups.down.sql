@@ -0,0 +1,4 @@
+DROP VIEW IF EXISTS submission_counts;
+DROP TABLE IF EXISTS rollup_state;
+DROP TABLE IF EXISTS submissions_daily;
+DROP TABLE IF EXISTS submissions_hourly;
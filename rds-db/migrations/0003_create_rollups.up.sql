@@ -0,0 +1,40 @@
+CREATE TABLE IF NOT EXISTS submissions_hourly (
+             username VARCHAR(255) NOT NULL,
+             timestamp TIMESTAMP NOT NULL,
+             submission_count BIGINT NOT NULL,
+             PRIMARY KEY (username, timestamp)
+);
+CREATE INDEX IF NOT EXISTS idx_hourly_time ON submissions_hourly (timestamp);
+
+CREATE TABLE IF NOT EXISTS submissions_daily (
+             username VARCHAR(255) NOT NULL,
+             timestamp TIMESTAMP NOT NULL,
+             submission_count BIGINT NOT NULL,
+             PRIMARY KEY (username, timestamp)
+);
+CREATE INDEX IF NOT EXISTS idx_daily_time ON submissions_daily (timestamp);
+
+-- name: hourly|daily
+-- last_window: end (exclusive) of the windows rolled up so far
+-- pruned_before: rows of the source table deleted before this time
+CREATE TABLE IF NOT EXISTS rollup_state (
+             name VARCHAR(32) PRIMARY KEY,
+             last_window TIMESTAMP,
+             pruned_before TIMESTAMP
+);
+
+-- every submission once at the finest precision retained:
+-- minute rows not rolled up yet, hourly rows whose minutes were pruned, daily rows whose hours were pruned
+CREATE OR REPLACE VIEW submission_counts AS
+WITH w AS (
+    SELECT COALESCE((SELECT last_window FROM rollup_state WHERE name = 'hourly'), '-infinity'::timestamp) AS hourly_done,
+           COALESCE((SELECT pruned_before FROM rollup_state WHERE name = 'daily'), '-infinity'::timestamp) AS hourly_pruned
+)
+SELECT s.username, s.timestamp, s.submission_count::BIGINT AS submission_count
+FROM submissions s, w WHERE s.timestamp >= w.hourly_done
+UNION ALL
+SELECT h.username, h.timestamp, h.submission_count
+FROM submissions_hourly h, w WHERE h.timestamp < w.hourly_done AND h.timestamp >= w.hourly_pruned
+UNION ALL
+SELECT d.username, d.timestamp, d.submission_count
+FROM submissions_daily d, w WHERE d.timestamp < w.hourly_pruned;
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS rejected_submissions (
+             username VARCHAR(255) NOT NULL,
+             timestamp TIMESTAMP NOT NULL,
+             reason VARCHAR(64) NOT NULL,
+             rejected_count INT NOT NULL,
+             CONSTRAINT unique_user_time_reason UNIQUE (username, timestamp, reason)
+);
+CREATE INDEX IF NOT EXISTS idx_rejected_time ON rejected_submissions (timestamp);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS ledger;
+DROP TABLE IF EXISTS payout_rounds;
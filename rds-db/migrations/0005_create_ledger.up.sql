@@ -0,0 +1,22 @@
+-- one row per payout calculation, ref makes each block or period credited once
+CREATE TABLE IF NOT EXISTS payout_rounds (
+             id BIGSERIAL PRIMARY KEY,
+             ref VARCHAR(128) NOT NULL UNIQUE,
+             scheme VARCHAR(16) NOT NULL,
+             reward BIGINT NOT NULL,
+             shares BIGINT NOT NULL,
+             window_from TIMESTAMP NOT NULL,
+             window_to TIMESTAMP NOT NULL,
+             created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+-- credits per user, amounts in the smallest currency unit
+CREATE TABLE IF NOT EXISTS ledger (
+             id BIGSERIAL PRIMARY KEY,
+             round_id BIGINT NOT NULL REFERENCES payout_rounds (id),
+             username VARCHAR(255) NOT NULL,
+             shares BIGINT NOT NULL,
+             amount BIGINT NOT NULL,
+             created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_ledger_username ON ledger (username, id);
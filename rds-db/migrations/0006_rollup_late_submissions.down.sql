@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS submissions_rollup_late ON submissions;
+DROP FUNCTION IF EXISTS rollup_late_submission();
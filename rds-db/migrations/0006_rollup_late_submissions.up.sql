@@ -0,0 +1,32 @@
+-- submissions written to minutes already rolled up, e.g. spool replays after an outage longer than the rollup
+-- lookback, are added to the rollups as they arrive; the view serves those minutes from the rollups
+CREATE OR REPLACE FUNCTION rollup_late_submission() RETURNS trigger AS $$
+DECLARE
+    delta BIGINT := NEW.submission_count;
+BEGIN
+    IF TG_OP = 'UPDATE' THEN
+        delta := NEW.submission_count - OLD.submission_count;
+    END IF;
+    IF delta = 0 THEN
+        RETURN NULL;
+    END IF;
+    IF NEW.timestamp < (SELECT last_window FROM rollup_state WHERE name = 'hourly') THEN
+        INSERT INTO submissions_hourly (username, timestamp, submission_count)
+        VALUES (NEW.username, date_trunc('hour', NEW.timestamp), delta)
+        ON CONFLICT (username, timestamp)
+        DO UPDATE SET submission_count = submissions_hourly.submission_count + EXCLUDED.submission_count;
+    END IF;
+    IF NEW.timestamp < (SELECT last_window FROM rollup_state WHERE name = 'daily') THEN
+        INSERT INTO submissions_daily (username, timestamp, submission_count)
+        VALUES (NEW.username, date_trunc('day', NEW.timestamp), delta)
+        ON CONFLICT (username, timestamp)
+        DO UPDATE SET submission_count = submissions_daily.submission_count + EXCLUDED.submission_count;
+    END IF;
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS submissions_rollup_late ON submissions;
+CREATE TRIGGER submissions_rollup_late
+    AFTER INSERT OR UPDATE OF submission_count ON submissions
+    FOR EACH ROW EXECUTE FUNCTION rollup_late_submission();
@@ -0,0 +1,60 @@
+package rds_db
+
+import (
+	"context"
+	"time"
+)
+
+const upsertSubmissionQuery = `
+	INSERT INTO submissions (username, timestamp, submission_count)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (username, timestamp)
+	DO UPDATE SET submission_count = submissions.submission_count + EXCLUDED.submission_count;
+`
+
+// UpsertSubmission add count accepted shares of username to its minute bucket
+func UpsertSubmission(ctx context.Context, username string, minute time.Time, count int) error {
+	_, err := ExecWithRetry(ctx, upsertSubmissionQuery, username, minute, count)
+	return err
+}
+
+// ReplaySubmission apply a spooled upsert once per id, applied is false when id was replayed before
+func ReplaySubmission(ctx context.Context, id, username string, minute time.Time, count int) (bool, error) {
+	conn, err := GetDb()
+	if err != nil {
+		return false, err
+	}
+	ctx, cancel := QueryContext(ctx)
+	defer cancel()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	result, err := tx.ExecContext(ctx, `INSERT INTO spool_replays (id) VALUES ($1) ON CONFLICT DO NOTHING`, id)
+	if err != nil {
+		return false, err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return false, nil
+	}
+	if _, err := tx.ExecContext(ctx, upsertSubmissionQuery, username, minute, count); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// UpsertRejection add count rejected shares of username for reason to its minute bucket
+func UpsertRejection(ctx context.Context, username string, minute time.Time, reason string, count int) error {
+	_, err := ExecWithRetry(ctx, `
+		INSERT INTO rejected_submissions (username, timestamp, reason, rejected_count)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (username, timestamp, reason)
+		DO UPDATE SET rejected_count = rejected_submissions.rejected_count + EXCLUDED.rejected_count;
+	`, username, minute, reason, count)
+	return err
+}
@@ -0,0 +1,74 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"luxor.tech/tcp_msg_processing_test/internal/accounting"
+	"luxor.tech/tcp_msg_processing_test/internal/admin"
+	"luxor.tech/tcp_msg_processing_test/internal/server"
+	rds_db "luxor.tech/tcp_msg_processing_test/rds-db"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccounting(t *testing.T) {
+	assert := require.New(t)
+
+	t.Run("split sums to reward", func(t *testing.T) {
+		credits := accounting.Split(100, map[string]int64{"alice": 1, "bob": 1, "carol": 1})
+		assert.Equal(map[string]int64{"alice": 34, "bob": 33, "carol": 33}, credits)
+
+		credits = accounting.Split(625_000_000, map[string]int64{"alice": 7, "bob": 3, "idle": 0})
+		assert.Equal(map[string]int64{"alice": 437_500_000, "bob": 187_500_000}, credits)
+
+		// no overflow on large rewards and share counts
+		credits = accounting.Split(1<<62, map[string]int64{"alice": 1 << 40, "bob": 3 << 40})
+		assert.Equal(int64(1<<60), credits["alice"])
+		assert.Equal(int64(3<<60), credits["bob"])
+
+		assert.Empty(accounting.Split(100, map[string]int64{}))
+		assert.Empty(accounting.Split(0, map[string]int64{"alice": 1}))
+	})
+
+	t.Run("pplns window", func(t *testing.T) {
+		t0 := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+		buckets := []accounting.Bucket{
+			{Username: "alice", Time: t0, Shares: 5},
+			{Username: "bob", Time: t0.Add(-time.Minute), Shares: 3},
+			{Username: "carol", Time: t0.Add(-time.Minute), Shares: 3},
+			{Username: "alice", Time: t0.Add(-time.Minute * 2), Shares: 100},
+		}
+		// the oldest minute reached is shared by bob and carol, split evenly
+		assert.Equal(map[string]int64{"alice": 5, "bob": 2, "carol": 1}, accounting.PPLNSShares(buckets, 8))
+		assert.Equal(map[string]int64{"alice": 15, "bob": 3, "carol": 3}, accounting.PPLNSShares(buckets, 21))
+		// fewer shares than n counts all of them
+		assert.Equal(map[string]int64{"alice": 105, "bob": 3, "carol": 3}, accounting.PPLNSShares(buckets, 1000))
+	})
+
+	t.Run("pps credits", func(t *testing.T) {
+		credits := accounting.PPSCredits(map[string]int64{"alice": 10, "bob": 0}, 250)
+		assert.Equal(map[string]int64{"alice": 2500}, credits)
+	})
+
+	t.Run("admin rejects bad params", func(t *testing.T) {
+		api := admin.NewAdmin("", "secret", server.NewServer())
+		db, err := rds_db.GetDb()
+		assert.Nil(err)
+		api.EnableAccounting(accounting.NewLedger(db))
+		srv := httptest.NewServer(api)
+		defer srv.Close()
+
+		for _, req := range []struct{ method, path, body string }{
+			{http.MethodPost, "/accounting/blocks", `{"ref":"b1","reward":0,"n":10}`},
+			{http.MethodPost, "/accounting/blocks", `{"reward":100,"n":10}`},
+			{http.MethodPost, "/accounting/periods", `{"from":"2024-05-02T00:00:00Z","to":"2024-05-01T00:00:00Z","rate":1}`},
+			{http.MethodGet, "/accounting/ledger?limit=0", ""},
+		} {
+			status, _, _ := adminRequest(t, req.method, srv.URL+req.path, "secret", req.body)
+			assert.Equal(http.StatusBadRequest, status, req.path)
+		}
+	})
+}
@@ -0,0 +1,149 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"luxor.tech/tcp_msg_processing_test/internal/admin"
+	"luxor.tech/tcp_msg_processing_test/internal/client"
+	"luxor.tech/tcp_msg_processing_test/internal/server"
+	"luxor.tech/tcp_msg_processing_test/internal/servertest"
+	"luxor.tech/tcp_msg_processing_test/pkg/logger"
+
+	"github.com/stretchr/testify/require"
+)
+
+func adminRequest(t *testing.T, method, url, token, body string) (int, map[string]interface{}, []byte) {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	require.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	require.Nil(t, err)
+	defer resp.Body.Close()
+
+	var raw json.RawMessage
+	require.Nil(t, json.NewDecoder(resp.Body).Decode(&raw))
+	var obj map[string]interface{}
+	_ = json.Unmarshal(raw, &obj)
+	return resp.StatusCode, obj, raw
+}
+
+func TestAdmin(t *testing.T) {
+	assert := require.New(t)
+	assert.Nil(logger.InitLogger("../config/log_config.json"))
+
+	// jobs on authorize, periodic ones wait for the fake clock
+	srv := servertest.NewServerWithJobs(t, server.DefaultConfig(), nil)
+	addr := srv.Addr
+
+	api := httptest.NewServer(admin.NewAdmin("", "secret", srv.Server))
+	defer api.Close()
+
+	username := "admin_user"
+	c := client.NewClient(addr, username, time.Second, time.Minute)
+	assert.Nil(c.Connect())
+	defer c.Close()
+	assert.Nil(c.Authorize())
+	job, err := c.ReceiveRequest() // sent on authorize
+	assert.Nil(err)
+	assert.Equal("job", job.Method)
+
+	t.Run("unauthorized", func(t *testing.T) {
+		status, _, _ := adminRequest(t, http.MethodGet, api.URL+"/sessions", "wrong", "")
+		assert.Equal(http.StatusUnauthorized, status)
+	})
+
+	var sessionID uint64
+	t.Run("list sessions", func(t *testing.T) {
+		status, _, raw := adminRequest(t, http.MethodGet, api.URL+"/sessions", "secret", "")
+		assert.Equal(http.StatusOK, status)
+		var sessions []server.SessionInfo
+		assert.Nil(json.Unmarshal(raw, &sessions))
+		for _, session := range sessions {
+			if session.Username == username {
+				sessionID = session.ID
+			}
+		}
+		assert.NotZero(sessionID)
+	})
+
+	t.Run("force job", func(t *testing.T) {
+		status, body, _ := adminRequest(t, http.MethodPost, api.URL+"/jobs", "secret", `{"username":"`+username+`"}`)
+		assert.Equal(http.StatusOK, status)
+		assert.Equal(float64(1), body["sent"])
+		job, err := c.ReceiveRequest()
+		assert.Nil(err)
+		assert.Equal("job", job.Method)
+	})
+
+	t.Run("view config", func(t *testing.T) {
+		status, body, _ := adminRequest(t, http.MethodGet, api.URL+"/config", "secret", "")
+		assert.Equal(http.StatusOK, status)
+		assert.Equal("30s", body["job_interval"])
+		assert.Equal("200ms", body["job_debounce"])
+		assert.Equal(float64(server.DefaultConfig().ExtranonceSize), body["extranonce_size"])
+	})
+
+	t.Run("log level", func(t *testing.T) {
+		status, body, _ := adminRequest(t, http.MethodPut, api.URL+"/log/level", "secret", `{"level":"debug"}`)
+		assert.Equal(http.StatusOK, status)
+		assert.Equal("debug", body["level"])
+		status, body, _ = adminRequest(t, http.MethodPut, api.URL+"/log/level", "secret", `{"level":""}`)
+		assert.Equal(http.StatusOK, status)
+		assert.Equal("info", body["level"])
+
+		status, body, _ = adminRequest(t, http.MethodPost, api.URL+"/log/debug", "secret", `{"username":"`+username+`"}`)
+		assert.Equal(http.StatusOK, status)
+		assert.Equal(map[string]interface{}{"username": []interface{}{username}}, body["debug_targets"])
+		status, _, _ = adminRequest(t, http.MethodDelete, api.URL+"/log/debug?username="+username, "secret", "")
+		assert.Equal(http.StatusOK, status)
+		assert.Empty(logger.DebugTargets()["username"])
+	})
+
+	t.Run("kick session", func(t *testing.T) {
+		status, _, _ := adminRequest(t, http.MethodDelete, fmt.Sprintf("%s/sessions/%d", api.URL, sessionID), "secret", "")
+		assert.Equal(http.StatusOK, status)
+		_, err := c.ReceiveRequest()
+		assert.NotNil(err)
+	})
+
+	t.Run("ban username", func(t *testing.T) {
+		status, _, _ := adminRequest(t, http.MethodPost, api.URL+"/bans", "secret", `{"username":"`+username+`"}`)
+		assert.Equal(http.StatusOK, status)
+
+		banned := client.NewClient(addr, username, time.Second, time.Minute)
+		assert.Nil(banned.Connect())
+		defer banned.Close()
+		assert.NotNil(banned.Authorize())
+
+		status, _, _ = adminRequest(t, http.MethodDelete, api.URL+"/bans?username="+username, "secret", "")
+		assert.Equal(http.StatusOK, status)
+		assert.False(srv.IsUsernameBanned(username))
+	})
+}
+
+func TestAdminServe(t *testing.T) {
+	assert := require.New(t)
+	ts := servertest.NewServer(t, server.DefaultConfig())
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(err)
+	served := make(chan error, 1)
+	go func() {
+		served <- admin.NewAdmin("", "secret", ts.Server).Serve(ln)
+	}()
+
+	status, _, _ := adminRequest(t, http.MethodGet, "http://"+ln.Addr().String()+"/sessions", "secret", "")
+	assert.Equal(http.StatusOK, status)
+
+	// the api goes down with the server
+	assert.Nil(ts.Close())
+	assert.Nil(<-served)
+	_, err = http.Get("http://" + ln.Addr().String() + "/sessions")
+	assert.NotNil(err)
+}
@@ -6,18 +6,17 @@ import (
 
 	"luxor.tech/tcp_msg_processing_test/internal/client"
 	"luxor.tech/tcp_msg_processing_test/internal/server"
-	"luxor.tech/tcp_msg_processing_test/pkg/logger"
-	rds_db "luxor.tech/tcp_msg_processing_test/rds-db"
+	"luxor.tech/tcp_msg_processing_test/internal/servertest"
 
 	"github.com/stretchr/testify/require"
 )
 
 func TestClient(t *testing.T) {
-	Init()
+	ts := servertest.NewServer(t, server.DefaultConfig())
 	assert := require.New(t)
 
 	// Initialize client
-	c := client.NewClient("localhost:8888", "test_user", time.Second, time.Minute)
+	c := client.NewClient(ts.Addr, "test_user", time.Second, time.Minute)
 	defer c.Close()
 
 	t.Run("authorize", func(t *testing.T) {
@@ -33,21 +32,3 @@ func TestUtils(t *testing.T) {
 	assert.Nil(err)
 	assert.Equal(11, len(nonce))
 }
-
-func Init() {
-	once.Do(func() {
-		err := logger.InitLogger("../config/log_config.json")
-		if err != nil {
-			panic("Failed to initialize logger: " + err.Error())
-		}
-		rds_db.GetDb()
-
-		go func() {
-			testServer = server.NewServer()
-			err := testServer.Start(":8888")
-			if err != nil {
-				panic(err)
-			}
-		}()
-	})
-}
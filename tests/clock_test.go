@@ -0,0 +1,197 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"luxor.tech/tcp_msg_processing_test/internal/client"
+	"luxor.tech/tcp_msg_processing_test/internal/server"
+	"luxor.tech/tcp_msg_processing_test/internal/servertest"
+	"luxor.tech/tcp_msg_processing_test/pkg/clock"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFakeClock(t *testing.T) {
+	assert := require.New(t)
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("ticker", func(t *testing.T) {
+		fake := clock.NewFake(start)
+		ticker := fake.NewTicker(time.Second)
+		defer ticker.Stop()
+
+		fake.Advance(time.Millisecond * 999)
+		assert.Len(ticker.C(), 0)
+		fake.Advance(time.Millisecond)
+		assert.Equal(start.Add(time.Second), <-ticker.C())
+
+		// missed ticks are dropped, the next one stays on the period grid
+		fake.Advance(time.Millisecond * 3500)
+		assert.Equal(start.Add(time.Millisecond*4500), <-ticker.C())
+		fake.Advance(time.Millisecond * 499)
+		assert.Len(ticker.C(), 0)
+		fake.Advance(time.Millisecond)
+		assert.Len(ticker.C(), 1)
+	})
+
+	t.Run("sleep", func(t *testing.T) {
+		fake := clock.NewFake(start)
+		woke := make(chan struct{})
+		go func() {
+			fake.Sleep(time.Minute)
+			close(woke)
+		}()
+		waitWaiters(t, fake, 1)
+		fake.Advance(time.Second * 59)
+		assert.Equal(1, fake.Waiters())
+		fake.Set(start.Add(time.Minute))
+		<-woke
+		assert.Equal(time.Minute, fake.Since(start))
+
+		fake.Set(start) // never backwards
+		assert.Equal(start.Add(time.Minute), fake.Now())
+	})
+
+	t.Run("timer", func(t *testing.T) {
+		fake := clock.NewFake(start)
+		timer := fake.NewTimer(time.Second)
+		assert.Equal(1, fake.Waiters())
+		fake.Advance(time.Second)
+		assert.Equal(start.Add(time.Second), <-timer.C())
+		assert.Zero(fake.Waiters())
+
+		// rearming keeps one waiter and drops the fire not received
+		for i := 0; i < 3; i++ {
+			timer.Reset(time.Second)
+		}
+		assert.Equal(1, fake.Waiters())
+		assert.Equal(4, fake.Waits())
+		fake.Advance(time.Second)
+		timer.Reset(time.Second)
+		assert.Len(timer.C(), 0)
+		timer.Stop()
+		assert.Zero(fake.Waiters())
+		fake.Advance(time.Second)
+		assert.Len(timer.C(), 0)
+	})
+}
+
+func TestServerClock(t *testing.T) {
+	assert := require.New(t)
+	cfg := server.DefaultConfig()
+	cfg.PingInterval, cfg.AuthTimeout = 0, 0 // no pings between submits and responses as the clock jumps
+	ts := servertest.NewServer(t, cfg)
+	c := client.NewClient(ts.Addr, "clocked", time.Second, time.Minute)
+	defer c.Close()
+	assert.Nil(c.Connect())
+	assert.Nil(c.Authorize())
+	ts.WaitSession(t, "clocked", nil)
+
+	submit := func() string {
+		job := ts.Job(t, "clocked")
+		clientNonce, result := c.CalculateResult(job)
+		resp, err := c.Submit(job.JobID, clientNonce, result, false)
+		assert.Nil(err)
+		return resp.Error
+	}
+	ts.Tick()
+	_, err := c.ReceiveRequest()
+	assert.Nil(err)
+
+	t.Run("rate limit", func(t *testing.T) {
+		assert.Equal("", submit())
+		ts.Clock.Advance(time.Millisecond * 999)
+		assert.Equal("Submission too frequent", submit())
+		ts.Clock.Advance(time.Millisecond)
+		assert.Equal("", submit())
+	})
+
+	t.Run("minute rollover", func(t *testing.T) {
+		ts.Clock.Set(servertest.Epoch.Add(time.Second * 59))
+		assert.Equal("", submit())
+		ts.Clock.Advance(time.Second)
+		assert.Equal("", submit())
+		assert.Equal(map[time.Time]int{
+			servertest.Epoch:                  3,
+			servertest.Epoch.Add(time.Minute): 1,
+		}, ts.Store.SubmissionsByMinute("clocked"))
+	})
+
+	t.Run("client pacing", func(t *testing.T) {
+		paced := client.NewClient(ts.Addr, "paced", time.Second, time.Minute)
+		defer paced.Close()
+		fake := clock.NewFake(servertest.Epoch)
+		paced.SetClock(fake)
+		assert.Nil(paced.Connect())
+		assert.Nil(paced.Authorize())
+		ts.WaitSession(t, "paced", nil)
+		ts.Tick()
+		_, err := paced.ReceiveRequest()
+		assert.Nil(err)
+		job := ts.Job(t, "paced")
+
+		clientNonce, result := paced.CalculateResult(job)
+		resp, err := paced.Submit(job.JobID, clientNonce, result, true)
+		assert.Nil(err)
+		assert.True(resp.Result)
+
+		done := make(chan *client.Response)
+		go func() {
+			clientNonce, result := paced.CalculateResult(job)
+			resp, _ := paced.Submit(job.JobID, clientNonce, result, true)
+			done <- resp
+		}()
+		waitWaiters(t, fake, 1) // held back by the client clock
+		ts.Clock.Advance(time.Second)
+		fake.Advance(time.Second)
+		assert.True((<-done).Result)
+	})
+
+	t.Run("auto submission", func(t *testing.T) {
+		auto := client.NewClient(ts.Addr, "auto", time.Second, time.Minute)
+		defer auto.Close()
+		fake := clock.NewFake(servertest.Epoch)
+		auto.SetClock(fake)
+		assert.Nil(auto.Connect())
+		assert.Nil(auto.Authorize())
+		ts.WaitSession(t, "auto", nil)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go auto.ReceiveTasks(ctx)
+		go auto.StartAutoSubmission(ctx)
+		ts.Tick()
+		ts.WaitSession(t, "auto", func(info server.SessionInfo) bool { return info.Accepted == 1 })
+		ts.Clock.Advance(time.Second)
+
+		// the share of the job is submitted again once nothing was sent for maxInterval
+		ts.WaitSession(t, "auto", func(info server.SessionInfo) bool {
+			fake.Advance(time.Second * 30)
+			return info.Accepted == 2
+		})
+	})
+}
+
+// waitWaiters block until n goroutines sleep on fake
+func waitWaiters(t *testing.T, fake *clock.Fake, n int) {
+	deadline := time.Now().Add(time.Second * 5)
+	for fake.Waiters() < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("no %d sleepers on the fake clock", n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// waitWaits block until fake counted n waits, a timer rearmed included
+func waitWaits(t *testing.T, fake *clock.Fake, n int) {
+	deadline := time.Now().Add(time.Second * 5)
+	for fake.Waits() < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("no %d waits on the fake clock", n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,87 @@
+package tests
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+
+	rds_db "luxor.tech/tcp_msg_processing_test/rds-db"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDbConfig(t *testing.T) {
+	assert := require.New(t)
+	file := filepath.Join(t.TempDir(), "db_config.json")
+	assert.Nil(os.WriteFile(file, []byte(`{"max_open_conns": 5, "query_timeout": "250ms"}`), 0600))
+
+	t.Setenv("DATABASE_URL", "postgres://env@localhost/db")
+	config, err := rds_db.LoadConfig(file)
+	assert.Nil(err)
+	assert.Equal(5, config.MaxOpenConns)
+	assert.Equal(rds_db.Duration(time.Millisecond*250), config.QueryTimeout)
+	assert.Equal(rds_db.DefaultConfig().MaxIdleConns, config.MaxIdleConns)
+	assert.Equal("postgres://env@localhost/db", config.DSN)
+
+	config, err = rds_db.LoadConfig("../config/db_config.json")
+	assert.Nil(err)
+	assert.Greater(config.MaxOpenConns, 0)
+
+	// the lazily opened pool keeps its config, a later Init with another one fails instead of being ignored
+	db, err := rds_db.GetDb()
+	assert.Nil(err)
+	assert.NotNil(db)
+	other := rds_db.DefaultConfig()
+	other.QueryTimeout++
+	assert.ErrorContains(rds_db.Init(other), "already opened")
+}
+
+func TestDbRetry(t *testing.T) {
+	assert := require.New(t)
+
+	t.Run("transient errors", func(t *testing.T) {
+		assert.True(rds_db.IsTransient(driver.ErrBadConn))
+		assert.True(rds_db.IsTransient(fmt.Errorf("wrapped: %w", &pq.Error{Code: "08001"})))
+		assert.True(rds_db.IsTransient(&pq.Error{Code: "40001"}))
+		assert.True(rds_db.IsTransient(&net.OpError{Op: "dial", Err: errors.New("connection refused")}))
+		// the statement may have committed before these, retrying would count it twice
+		assert.False(rds_db.IsTransient(&pq.Error{Code: "08006"})) // connection_failure
+		assert.False(rds_db.IsTransient(io.ErrUnexpectedEOF))
+		assert.False(rds_db.IsTransient(context.DeadlineExceeded))
+		assert.False(rds_db.IsTransient(&net.OpError{Op: "read", Err: errors.New("connection reset")}))
+		assert.False(rds_db.IsTransient(&pq.Error{Code: "23505"})) // unique_violation
+		assert.False(rds_db.IsTransient(errors.New("syntax error")))
+	})
+
+	t.Run("retry until success", func(t *testing.T) {
+		calls := 0
+		err := rds_db.Retry(context.Background(), 3, func(context.Context) error {
+			calls++
+			if calls < 3 {
+				return driver.ErrBadConn
+			}
+			return nil
+		})
+		assert.Nil(err)
+		assert.Equal(3, calls)
+	})
+
+	t.Run("permanent error not retried", func(t *testing.T) {
+		calls := 0
+		err := rds_db.Retry(context.Background(), 3, func(context.Context) error {
+			calls++
+			return &pq.Error{Code: "23505"}
+		})
+		assert.NotNil(err)
+		assert.Equal(1, calls)
+	})
+}
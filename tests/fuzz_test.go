@@ -0,0 +1,118 @@
+package tests
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"luxor.tech/tcp_msg_processing_test/internal/server"
+	"luxor.tech/tcp_msg_processing_test/internal/servertest"
+)
+
+const fuzzPingID = `{"id":987654321,"method":"ping"}`
+
+// FuzzProtocol feed arbitrary lines to an authorized session holding a job; the connection must
+// answer a ping afterwards and no panic may have been recovered.
+// go test ./tests -run '^$' -fuzz FuzzProtocol -fuzztime 1m
+func FuzzProtocol(f *testing.F) {
+	for _, seed := range []string{
+		`{"method":"authorize","params":{"username":5}}`,
+		`{"method":"authorize","params":{"username":null}}`,
+		`{"method":"authorize","params":{"username":""}}`,
+		`{"method":"authorize","params":{"username":["a"]}}`,
+		`{"method":"authorize"}`,
+		`{"method":"authorize","params":null}`,
+		`{"id":1,"method":"authorize","params":{"username":"other"}}`,
+		`{"method":"submit","params":{"job_id":1,"client_nonce":"n","result":"r"}}`,
+		`{"method":"submit","params":{"job_id":1.9,"client_nonce":"n","result":"r"}}`,
+		`{"method":"submit","params":{"job_id":-1,"client_nonce":"n","result":"r"}}`,
+		`{"method":"submit","params":{"job_id":1e308,"client_nonce":"n","result":"r"}}`,
+		`{"method":"submit","params":{"job_id":"1","client_nonce":5,"result":{}}}`,
+		`{"method":"submit","params":{}}`,
+		`{"method":"submit"}`,
+		`{"id":"x","method":"ping"}`,
+		`{"method":"pong"}`,
+		`{"method":"job","params":{"job_id":1}}`,
+		`{"method":5}`,
+		`[]`,
+		`null`,
+		`{`,
+		"\x00\xff",
+		"",
+	} {
+		f.Add(seed)
+	}
+
+	cfg := server.DefaultConfig()
+	cfg.PingInterval, cfg.AuthTimeout = 0, 0
+	ts := servertest.NewServer(f, cfg)
+
+	f.Fuzz(func(t *testing.T, message string) {
+		panics := connectionPanics(t)
+		conn := ts.Pipe()
+		defer conn.Close()
+		lines := make(chan string, 16)
+		go func() {
+			defer close(lines)
+			reader := bufio.NewReader(conn)
+			for {
+				line, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				lines <- line
+			}
+		}()
+		await := func(want string) {
+			timeout := time.After(time.Second * 5)
+			for {
+				select {
+				case line, ok := <-lines:
+					if !ok {
+						t.Fatalf("connection closed waiting for %s, after %q", want, message)
+					}
+					if strings.Contains(line, want) {
+						return
+					}
+				case <-timeout:
+					t.Fatalf("no %s within 5s, after %q", want, message)
+				}
+			}
+		}
+		write := func(line string) {
+			_ = conn.SetWriteDeadline(time.Now().Add(time.Second * 5))
+			if _, err := conn.Write([]byte(line + "\n")); err != nil {
+				t.Fatalf("write %q: %v", line, err)
+			}
+		}
+
+		write(`{"id":1,"method":"authorize","params":{"username":"fuzz"}}`)
+		await(`"result":true`)
+		ts.DistributeTo("fuzz")
+		await(`"method":"job"`)
+
+		write(strings.ReplaceAll(message, "\n", " "))
+		write(fuzzPingID)
+		await(`"id":987654321,"method":"pong"`)
+		if got := connectionPanics(t); got != panics {
+			t.Fatalf("panic recovered handling %q", message)
+		}
+	})
+}
+
+// connectionPanics current value of the recovered panics counter
+func connectionPanics(t *testing.T) float64 {
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() == "tcpmsg_server_connection_panics_total" {
+			return family.GetMetric()[0].GetCounter().GetValue()
+		}
+	}
+	return 0
+}
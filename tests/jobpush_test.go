@@ -0,0 +1,201 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"luxor.tech/tcp_msg_processing_test/internal/admin"
+	"luxor.tech/tcp_msg_processing_test/internal/client"
+	"luxor.tech/tcp_msg_processing_test/internal/jobsource"
+	"luxor.tech/tcp_msg_processing_test/internal/server"
+	"luxor.tech/tcp_msg_processing_test/internal/servertest"
+	"luxor.tech/tcp_msg_processing_test/pkg/clock"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJobPush(t *testing.T) {
+	assert := require.New(t)
+
+	template, err := jobsource.NewTemplate(genesis)
+	assert.Nil(err)
+	cfg := server.DefaultConfig()
+	cfg.PingInterval, cfg.AuthTimeout = 0, 0
+	cfg.JobInterval, cfg.JobMinInterval, cfg.JobDebounce = time.Second*30, time.Second, time.Millisecond*300
+	ts := servertest.NewServerWithJobs(t, cfg, template)
+
+	c := client.NewClient(ts.Addr, "pushed", time.Second, time.Minute)
+	defer c.Close()
+	assert.Nil(c.Connect())
+	receive := func() client.Task {
+		req, err := c.ReceiveRequest()
+		assert.Nil(err)
+		assert.Equal("job", req.Method)
+		job, err := req.Job()
+		assert.Nil(err)
+		return job
+	}
+	// set a template with another prev hash, once the job loop took the change into account
+	set := func(prevHash string) string {
+		next := genesis
+		next.PrevHash = strings.Repeat(prevHash, 64)
+		waits := ts.Clock.Waits()
+		assert.Nil(template.Set(next))
+		waitWaits(t, ts.Clock, waits+1)
+		nonce, _ := next.ServerNonce()
+		return nonce
+	}
+	jobID := func() int {
+		return ts.Job(t, "pushed").JobID
+	}
+
+	// no wait for the interval after authorize
+	assert.Nil(c.Authorize())
+	first := receive()
+	assert.Equal(1, first.JobID)
+	assert.True(first.CleanJobs)
+
+	t.Run("min interval", func(t *testing.T) {
+		nonce := set("1")
+		ts.Clock.Advance(time.Millisecond * 300) // debounced, but within the min interval of the previous job
+		assert.Equal(1, jobID())
+		ts.Clock.Advance(time.Millisecond * 700)
+		job := receive()
+		assert.Equal(2, job.JobID)
+		assert.Equal(nonce, job.ServerNonce)
+		assert.True(job.CleanJobs)
+	})
+
+	t.Run("debounce", func(t *testing.T) {
+		ts.Clock.Advance(time.Second * 5)
+		set("2")
+		ts.Clock.Advance(time.Millisecond * 200)
+		nonce := set("3") // restarts the quiet time
+		ts.Clock.Advance(time.Millisecond * 200)
+		assert.Equal(2, jobID())
+		ts.Clock.Advance(time.Millisecond * 100)
+		job := receive()
+		assert.Equal(3, job.JobID)
+		assert.Equal(nonce, job.ServerNonce)
+	})
+
+	t.Run("max interval", func(t *testing.T) {
+		ts.Clock.Advance(cfg.JobInterval)
+		job := receive()
+		assert.Equal(4, job.JobID)
+		assert.False(job.CleanJobs) // same template
+	})
+
+	t.Run("continuous changes", func(t *testing.T) {
+		ts.Clock.Advance(time.Second * 5)
+		var nonce string
+		for _, prevHash := range []string{"4", "5", "6", "7", "8"} {
+			nonce = set(prevHash)
+			ts.Clock.Advance(time.Millisecond * 200) // each change within the debounce of the previous one
+		}
+		job := receive()
+		assert.Equal(5, job.JobID)
+		assert.Equal(nonce, job.ServerNonce)
+	})
+
+	t.Run("admin template", func(t *testing.T) {
+		a := admin.NewAdmin("", "secret", ts.Server)
+		a.EnableTemplates(template)
+		api := httptest.NewServer(a)
+		defer api.Close()
+
+		next := genesis
+		next.NTime++
+		body, _ := json.Marshal(next)
+		status, _, raw := adminRequest(t, http.MethodPut, api.URL+"/jobs/template", "secret", string(body))
+		assert.Equal(http.StatusOK, status)
+		var current jobsource.BlockTemplate
+		assert.Nil(json.Unmarshal(raw, &current))
+		assert.Equal(next, current)
+		assert.Equal(next, template.Current())
+
+		status, _, _ = adminRequest(t, http.MethodPut, api.URL+"/jobs/template", "secret", `{"merkle_root":"zz"}`)
+		assert.Equal(http.StatusBadRequest, status)
+	})
+}
+
+func TestJobPushSourceSet(t *testing.T) {
+	assert := require.New(t)
+
+	cfg := server.DefaultConfig()
+	cfg.PingInterval, cfg.AuthTimeout, cfg.JobInterval = 0, 0, 0
+	ts := servertest.NewServerWithJobs(t, cfg, nil)
+	c := client.NewClient(ts.Addr, "swapped", time.Second, time.Minute)
+	defer c.Close()
+	assert.Nil(c.Connect())
+	assert.Nil(c.Authorize())
+	_, err := c.ReceiveRequest() // random job on authorize
+	assert.Nil(err)
+
+	// a source set while serving has its changes pushed
+	template, err := jobsource.NewTemplate(genesis)
+	assert.Nil(err)
+	ts.SetJobSource(template)
+	next := genesis
+	next.PrevHash = strings.Repeat("1", 64)
+	assert.Nil(template.Set(next))
+	waitWaiters(t, ts.Clock, 1)
+	ts.Clock.Advance(cfg.JobMinInterval)
+	req, err := c.ReceiveRequest()
+	assert.Nil(err)
+	job, err := req.Job()
+	assert.Nil(err)
+	nonce, _ := next.ServerNonce()
+	assert.Equal(nonce, job.ServerNonce)
+}
+
+func TestWatchTemplate(t *testing.T) {
+	assert := require.New(t)
+
+	path := filepath.Join(t.TempDir(), "template.json")
+	write := func(template jobsource.BlockTemplate) {
+		data, _ := json.Marshal(template)
+		assert.Nil(os.WriteFile(path, data, 0644))
+	}
+	write(genesis)
+	loaded, err := jobsource.LoadTemplate(path)
+	assert.Nil(err)
+	assert.Equal(genesis, loaded)
+	template, err := jobsource.NewTemplate(loaded)
+	assert.Nil(err)
+
+	fake := clock.NewFake(servertest.Epoch)
+	done := make(chan struct{})
+	defer close(done)
+	go jobsource.WatchTemplate(path, template, fake, time.Second, done)
+
+	next := genesis
+	next.PrevHash = strings.Repeat("ab", 32)
+	write(next)
+	assert.Eventually(func() bool {
+		fake.Advance(time.Second)
+		return template.Current() == next
+	}, time.Second*5, time.Millisecond*10)
+	select {
+	case <-template.JobChanges():
+	default:
+		t.Fatal("no change signalled")
+	}
+
+	// a broken file keeps the current template
+	assert.Nil(os.WriteFile(path, []byte(`{"version":`), 0644))
+	for i := 0; i < 3; i++ {
+		fake.Advance(time.Second)
+		time.Sleep(time.Millisecond * 10)
+	}
+	assert.Equal(next, template.Current())
+	_, err = jobsource.LoadTemplate(path)
+	assert.ErrorContains(err, fmt.Sprintf("%s: invalid block template", path))
+}
@@ -0,0 +1,144 @@
+package tests
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+	"time"
+
+	"luxor.tech/tcp_msg_processing_test/internal/client"
+	"luxor.tech/tcp_msg_processing_test/internal/jobsource"
+	"luxor.tech/tcp_msg_processing_test/internal/server"
+	"luxor.tech/tcp_msg_processing_test/internal/servertest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNetworkJobs(t *testing.T) {
+	assert := require.New(t)
+
+	template, err := jobsource.NewTemplate(genesis)
+	assert.Nil(err)
+	cfg := server.DefaultConfig()
+	cfg.PingInterval, cfg.AuthTimeout = 0, 0
+	ts := servertest.NewServer(t, cfg)
+	ts.SetJobSource(template)
+
+	var clients []*client.Client
+	for _, username := range []string{"alice", "bob"} {
+		c := client.NewClient(ts.Addr, username, time.Second, time.Minute)
+		t.Cleanup(c.Close)
+		assert.Nil(c.Connect())
+		assert.Nil(c.Authorize())
+		ts.WaitSession(t, username, nil)
+		clients = append(clients, c)
+	}
+	receive := func(c *client.Client) client.Task {
+		req, err := c.ReceiveRequest()
+		assert.Nil(err)
+		job, err := req.Job()
+		assert.Nil(err)
+		return job
+	}
+	submit := func(c *client.Client, job client.Task) string {
+		ts.Clock.Advance(time.Second) // rate limit
+		clientNonce, result := c.CalculateResult(job)
+		resp, err := c.Submit(job.JobID, clientNonce, result, false)
+		assert.Nil(err)
+		return resp.Error
+	}
+
+	// one network job, distinct work per session
+	assert.Equal(2, ts.Tick())
+	first, other := receive(clients[0]), receive(clients[1])
+	assert.Equal(first.JobID, other.JobID)
+	assert.Equal(first.ServerNonce, other.ServerNonce)
+	assert.True(first.CleanJobs)
+	assert.Len(first.Extranonce, 8)
+	assert.NotEqual(first.Extranonce, other.Extranonce)
+	assert.NotEqual(first.Result("n1"), other.Result("n1"))
+	assert.Equal("", submit(clients[0], first))
+	// a share of alice's work is invalid for bob
+	clientNonce, result := clients[0].CalculateResult(first)
+	resp, err := clients[1].Submit(other.JobID, clientNonce, result, false)
+	assert.Nil(err)
+	assert.Equal("Invalid result", resp.Error)
+
+	// same tip: earlier jobs are still accepted
+	ts.Tick()
+	second := receive(clients[0])
+	receive(clients[1])
+	assert.Equal(first.JobID+1, second.JobID)
+	assert.False(second.CleanJobs)
+	assert.Equal("", submit(clients[0], first))
+	assert.Equal("", submit(clients[0], second))
+	// a client nonce counts once until a clean job
+	reuse := func(job client.Task) string {
+		ts.Clock.Advance(time.Second)
+		resp, err := clients[0].Submit(job.JobID, "reused", job.Result("reused"), false)
+		assert.Nil(err)
+		return resp.Error
+	}
+	assert.Equal("", reuse(second))
+	assert.Equal("Duplicate submission", reuse(first))
+
+	// new tip: work on earlier jobs is abandoned
+	next := genesis
+	next.PrevHash = strings.Repeat("1", 64)
+	assert.Nil(template.Set(next))
+	ts.Tick()
+	third := receive(clients[0])
+	receive(clients[1])
+	assert.True(third.CleanJobs)
+	assert.Equal("Task does not exist", submit(clients[0], second))
+	assert.Equal("", submit(clients[0], third))
+	assert.Equal("", reuse(third))
+
+	// an admin push resends the current job instead of making a new one
+	assert.Equal(1, ts.DistributeTo("bob"))
+	assert.Equal(third.JobID, receive(clients[1]).JobID)
+
+	t.Run("slow client", func(t *testing.T) {
+		ts := servertest.NewServer(t, cfg)
+		// a pipe client never reading its job blocks the write to it
+		stalled := ts.Pipe()
+		defer stalled.Close()
+		_, err := stalled.Write([]byte(`{"id":1,"method":"authorize","params":{"username":"stalled"}}` + "\n"))
+		assert.Nil(err)
+		_, err = bufio.NewReader(stalled).ReadString('\n')
+		assert.Nil(err)
+		c := client.NewClient(ts.Addr, "fast", time.Second, time.Minute)
+		defer c.Close()
+		assert.Nil(c.Connect())
+		assert.Nil(c.Authorize())
+		ts.WaitSession(t, "fast", nil)
+
+		sent := make(chan int)
+		go func() { sent <- ts.Tick() }()
+		// other clients get the job and sessions stay reachable meanwhile
+		receive(c)
+		_, ok := ts.Session("stalled")
+		assert.True(ok)
+		stalled.Close()
+		assert.Equal(2, <-sent)
+		ts.WaitSession(t, "fast", func(server.SessionInfo) bool {
+			_, ok := ts.Session("stalled")
+			return !ok
+		})
+	})
+
+	t.Run("no extranonce", func(t *testing.T) {
+		cfg := server.DefaultConfig()
+		cfg.ExtranonceSize = 0
+		ts := servertest.NewServer(t, cfg)
+		c := client.NewClient(ts.Addr, "plain", time.Second, time.Minute)
+		defer c.Close()
+		assert.Nil(c.Connect())
+		assert.Nil(c.Authorize())
+		ts.WaitSession(t, "plain", nil)
+		ts.Tick()
+		job := receive(c)
+		assert.Equal("", job.Extranonce)
+		assert.Equal("", submit(c, job))
+	})
+}
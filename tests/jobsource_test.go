@@ -0,0 +1,127 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"luxor.tech/tcp_msg_processing_test/internal/client"
+	"luxor.tech/tcp_msg_processing_test/internal/jobsource"
+	"luxor.tech/tcp_msg_processing_test/internal/protocol"
+	"luxor.tech/tcp_msg_processing_test/internal/server"
+	"luxor.tech/tcp_msg_processing_test/internal/servertest"
+
+	"github.com/stretchr/testify/require"
+)
+
+var genesis = jobsource.BlockTemplate{
+	Version:    1,
+	PrevHash:   strings.Repeat("0", 64),
+	MerkleRoot: "4a5e1e4baab89f3a32518a88c31bc87f618f76673e2cc77ab2127b7afdeda33b",
+	NTime:      1231006505,
+	NBits:      0x1d00ffff,
+}
+
+func TestBlockTemplate(t *testing.T) {
+	assert := require.New(t)
+
+	hash, err := genesis.BlockHash(2083236893)
+	assert.Nil(err)
+	assert.Equal("000000000019d6689c085ae165831e934ff763ae46a2a6c172b3f1b60a8ce26f", hash)
+
+	nonce, err := genesis.ServerNonce()
+	assert.Nil(err)
+	assert.Nil((&protocol.JobParams{JobID: 1, ServerNonce: nonce}).Validate())
+
+	bad := genesis
+	bad.MerkleRoot = "abc"
+	_, err = bad.ServerNonce()
+	assert.ErrorContains(err, "merkle_root")
+}
+
+func TestJobSource(t *testing.T) {
+	assert := require.New(t)
+
+	// tick the session of username and return the server nonce it received
+	receive := func(ts *servertest.Server, c *client.Client, username string) string {
+		assert.Equal(1, ts.Tick())
+		req, err := c.ReceiveRequest()
+		assert.Nil(err)
+		job, err := req.Job()
+		assert.Nil(err)
+		assert.Equal(ts.Job(t, username).ServerNonce, job.ServerNonce)
+		return job.ServerNonce
+	}
+	connect := func(source server.JobSource) (*servertest.Server, *client.Client) {
+		ts := servertest.NewServer(t, server.DefaultConfig())
+		if source != nil {
+			ts.SetJobSource(source)
+		}
+		c := client.NewClient(ts.Addr, "jobs", time.Second, time.Minute)
+		t.Cleanup(c.Close)
+		assert.Nil(c.Connect())
+		assert.Nil(c.Authorize())
+		ts.WaitSession(t, "jobs", nil)
+		return ts, c
+	}
+
+	t.Run("random", func(t *testing.T) {
+		ts, c := connect(nil)
+		first, second := receive(ts, c, "jobs"), receive(ts, c, "jobs")
+		assert.Len(first, 32)
+		assert.NotEqual(first, second)
+	})
+
+	t.Run("template", func(t *testing.T) {
+		template, err := jobsource.NewTemplate(genesis)
+		assert.Nil(err)
+		ts, c := connect(template)
+		nonce, _ := genesis.ServerNonce()
+		assert.Equal(nonce, receive(ts, c, "jobs"))
+		assert.Equal(nonce, receive(ts, c, "jobs"))
+
+		next := genesis
+		next.NTime++
+		assert.Nil(template.Set(next))
+		assert.NotEqual(nonce, receive(ts, c, "jobs"))
+	})
+
+	t.Run("file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "jobs.txt")
+		assert.Nil(os.WriteFile(path, []byte(`# queued jobs
+{"version":1,"prev_hash":"`+genesis.PrevHash+`","merkle_root":"`+genesis.MerkleRoot+`","ntime":1231006505,"nbits":486604799}
+
+abc123
+`), 0644))
+		queue, err := jobsource.NewFileQueue(path)
+		assert.Nil(err)
+		assert.Equal(2, queue.Len())
+		ts, c := connect(queue)
+		nonce, _ := genesis.ServerNonce()
+		assert.Equal(nonce, receive(ts, c, "jobs"))
+		assert.Equal("abc123", receive(ts, c, "jobs"))
+		// drained, the last job repeats
+		assert.Equal("abc123", receive(ts, c, "jobs"))
+
+		assert.Nil(os.WriteFile(path, []byte("abc123\nnot a nonce\n"), 0644))
+		_, err = jobsource.NewFileQueue(path)
+		assert.ErrorContains(err, "jobs.txt:2")
+		_, err = jobsource.NewQueue().NextJob()
+		assert.ErrorIs(err, jobsource.ErrNoJob)
+	})
+
+	t.Run("node", func(t *testing.T) {
+		node := jobsource.NewNode(servertest.NewServer(t, server.DefaultConfig()).Clock)
+		ts, c := connect(node)
+		first := receive(ts, c, "jobs")
+		tip := node.Current()
+		next := node.NewBlock()
+		prevHash, _ := tip.BlockHash(0)
+		assert.Equal(prevHash, next.PrevHash)
+		assert.Greater(next.NTime, tip.NTime)
+		assert.Equal(uint64(1), node.Height())
+		assert.NotEqual(first, receive(ts, c, "jobs"))
+	})
+}
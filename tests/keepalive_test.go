@@ -0,0 +1,75 @@
+package tests
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"luxor.tech/tcp_msg_processing_test/internal/server"
+	"luxor.tech/tcp_msg_processing_test/internal/servertest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeepalive(t *testing.T) {
+	assert := require.New(t)
+	cfg := server.DefaultConfig()
+	ts := servertest.NewServer(t, cfg)
+
+	// sessions are checked on the fake clock, the keepalive loop may check them too
+	checkAfter := func(d time.Duration) {
+		ts.Clock.Advance(d)
+		ts.CheckSessions(ts.Clock.Now())
+	}
+
+	t.Run("reap unauthorized session", func(t *testing.T) {
+		conn, err := net.Dial("tcp", ts.Addr)
+		assert.Nil(err)
+		defer conn.Close()
+		ts.WaitSession(t, "", nil)
+
+		checkAfter(cfg.AuthTimeout)
+		_ = conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+		_, err = bufio.NewReader(conn).ReadString('\n')
+		var netErr net.Error
+		assert.NotNil(err)
+		assert.False(errors.As(err, &netErr) && netErr.Timeout(), "connection should be closed by server")
+	})
+
+	t.Run("ping pong", func(t *testing.T) {
+		conn, err := net.Dial("tcp", ts.Addr)
+		assert.Nil(err)
+		defer conn.Close()
+		_, err = conn.Write([]byte(`{"id":7,"method":"ping"}` + "\n"))
+		assert.Nil(err)
+
+		line, err := bufio.NewReader(conn).ReadString('\n')
+		assert.Nil(err)
+		var pong server.Request
+		assert.Nil(json.Unmarshal([]byte(line), &pong))
+		assert.Equal("pong", pong.Method)
+		assert.Equal(7, *pong.ID)
+	})
+
+	t.Run("server pings idle session", func(t *testing.T) {
+		conn, err := net.Dial("tcp", ts.Addr)
+		assert.Nil(err)
+		defer conn.Close()
+		_, err = conn.Write([]byte(`{"id":1,"method":"authorize","params":{"username":"keepalive"}}` + "\n"))
+		assert.Nil(err)
+		reader := bufio.NewReader(conn)
+		_, err = reader.ReadString('\n') // authorize response
+		assert.Nil(err)
+
+		checkAfter(cfg.PingInterval)
+		_ = conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+		line, err := reader.ReadString('\n')
+		assert.Nil(err)
+		var ping server.Request
+		assert.Nil(json.Unmarshal([]byte(line), &ping))
+		assert.Equal("ping", ping.Method)
+	})
+}
@@ -0,0 +1,91 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"luxor.tech/tcp_msg_processing_test/internal/admin"
+	"luxor.tech/tcp_msg_processing_test/internal/loadgen"
+	"luxor.tech/tcp_msg_processing_test/internal/server"
+	"luxor.tech/tcp_msg_processing_test/internal/servertest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadgen(t *testing.T) {
+	assert := require.New(t)
+
+	t.Run("percentile", func(t *testing.T) {
+		sorted := []time.Duration{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+		assert.Equal(time.Duration(5), loadgen.Percentile(sorted, 50))
+		assert.Equal(time.Duration(9), loadgen.Percentile(sorted, 90))
+		assert.Equal(time.Duration(10), loadgen.Percentile(sorted, 99))
+		assert.Equal(time.Duration(1), loadgen.Percentile(sorted, 0.1))
+		assert.Equal(time.Duration(0), loadgen.Percentile(nil, 50))
+	})
+
+	t.Run("parse metrics", func(t *testing.T) {
+		samples, err := loadgen.ParseMetrics(strings.NewReader(`# HELP go_goroutines Number of goroutines.
+# TYPE go_goroutines gauge
+go_goroutines 42
+process_resident_memory_bytes 1.2e+07
+tcpmsg_server_shares_total{result="accepted",reason=""} 7
+`))
+		assert.Nil(err)
+		assert.Equal(map[string]float64{"go_goroutines": 42, "process_resident_memory_bytes": 1.2e7}, samples)
+	})
+
+	t.Run("run", func(t *testing.T) {
+		srv := server.NewServerWithConfig(server.Config{IdleTimeout: time.Minute})
+		srv.SetStore(servertest.NewMemStore())
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.Nil(err)
+		go func() {
+			_ = srv.Serve(ln)
+		}()
+		defer srv.Close()
+		adminAPI := httptest.NewServer(admin.NewAdmin("", "secret", srv))
+		defer adminAPI.Close()
+		metricsAPI := httptest.NewServer(promhttp.Handler())
+		defer metricsAPI.Close()
+
+		cfg := loadgen.DefaultConfig()
+		cfg.Addr = ln.Addr().String()
+		cfg.Clients = 20
+		cfg.Ramp = time.Millisecond * 100
+		cfg.Duration = time.Second * 2
+		cfg.Rate = 4 // beyond the server rate limit
+		cfg.Invalid, cfg.Duplicate, cfg.Flooders = 0.2, 0.1, 0.1
+		cfg.JobWait = time.Second
+		cfg.AdminURL, cfg.AdminToken = adminAPI.URL, "secret"
+		cfg.MetricsURL = metricsAPI.URL
+		report, err := loadgen.Run(context.Background(), cfg)
+		assert.Nil(err)
+
+		assert.Equal(20, report.Connected)
+		assert.Equal(20, report.GotJob)
+		assert.Equal(int64(0), report.Errors)
+		assert.Equal(report.Submitted, report.Accepted+report.Rejected)
+		assert.Greater(report.Accepted, int64(0))
+		assert.Greater(report.Rejections["Invalid result"], int64(0))
+		assert.Greater(report.Rejections["Submission too frequent"], int64(0))
+		assert.Greater(report.Latency.P99, float64(0))
+		assert.NotNil(report.Server)
+		assert.Greater(report.Server.PeakConnections, float64(0))
+
+		var buf bytes.Buffer
+		assert.Nil(report.Write(&buf, "csv"))
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		assert.Len(lines, 2)
+		assert.True(strings.HasPrefix(lines[0], "clients,connected,authorized,got_job,seconds,submitted"))
+		assert.Contains(lines[0], "rejected:Invalid result")
+		assert.NotNil(report.Write(&buf, "xml"))
+	})
+}
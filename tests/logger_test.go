@@ -0,0 +1,176 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"luxor.tech/tcp_msg_processing_test/pkg/logger"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogger(t *testing.T) {
+	assert := require.New(t)
+
+	t.Run("level filter and json fields", func(t *testing.T) {
+		var buf bytes.Buffer
+		l, err := logger.NewLogger(&buf, logger.Config{LogLevel: "warn", LogFormat: "json", LogTimeFormat: "2006-01-02"})
+		assert.Nil(err)
+
+		l.Info("dropped %d", 1)
+		l.With("session_id", 7).Warnw("share rejected", "username", "alice", "job_id", 3)
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		assert.Len(lines, 1)
+		var record map[string]interface{}
+		assert.Nil(json.Unmarshal([]byte(lines[0]), &record))
+		assert.Equal("WARN", record["level"])
+		assert.Equal("share rejected", record["msg"])
+		assert.Equal(float64(7), record["session_id"])
+		assert.Equal("alice", record["username"])
+		assert.Len(record["time"], len("2006-01-02"))
+	})
+
+	t.Run("text format", func(t *testing.T) {
+		var buf bytes.Buffer
+		l, err := logger.NewLogger(&buf, logger.Config{LogLevel: "debug"})
+		assert.Nil(err)
+		l.Debug("job %d sent", 5)
+		assert.Contains(buf.String(), `level=DEBUG msg="job 5 sent"`)
+	})
+
+	t.Run("invalid config", func(t *testing.T) {
+		_, err := logger.NewLogger(os.Stdout, logger.Config{LogLevel: "loud"})
+		assert.NotNil(err)
+		_, err = logger.NewLogger(os.Stdout, logger.Config{LogFormat: "xml"})
+		assert.NotNil(err)
+	})
+
+	t.Run("init from file", func(t *testing.T) {
+		dir := t.TempDir()
+		logFile := filepath.Join(dir, "out.log")
+		config := filepath.Join(dir, "log_config.json")
+		assert.Nil(os.WriteFile(config, []byte(`{"log_file":"`+logFile+`","log_level":"error"}`), 0600))
+		assert.Nil(logger.InitLogger(config))
+		defer func() {
+			assert.Nil(logger.InitLogger("../config/log_config.json"))
+		}()
+
+		logger.Info("filtered")
+		logger.Error("kept %s", "error")
+		data, err := os.ReadFile(logFile)
+		assert.Nil(err)
+		assert.NotContains(string(data), "filtered")
+		assert.Contains(string(data), "kept error")
+	})
+}
+
+func TestLoggerRotation(t *testing.T) {
+	assert := require.New(t)
+	path := filepath.Join(t.TempDir(), "rotate.log")
+	file := &logger.RotatingFile{Path: path, MaxSize: 100, MaxBackups: 2, Compress: true}
+	assert.Nil(file.Open())
+	defer file.Close()
+
+	line := []byte(strings.Repeat("x", 59) + "\n")
+	for i := 0; i < 8; i++ {
+		_, err := file.Write(line)
+		assert.Nil(err)
+		time.Sleep(time.Millisecond * 2) // distinct backup timestamps
+	}
+
+	assert.Eventually(func() bool {
+		backups, _ := filepath.Glob(path + ".*")
+		if len(backups) != 2 {
+			return false
+		}
+		for _, backup := range backups {
+			if !strings.HasSuffix(backup, ".gz") {
+				return false
+			}
+		}
+		return true
+	}, time.Second*2, time.Millisecond*20)
+	info, err := os.Stat(path)
+	assert.Nil(err)
+	assert.LessOrEqual(info.Size(), int64(100))
+}
+
+func TestLoggerSinks(t *testing.T) {
+	assert := require.New(t)
+	collector, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(err)
+	defer collector.Close()
+
+	dir := t.TempDir()
+	logFile := filepath.Join(dir, "sink.log")
+	config := filepath.Join(dir, "log_config.json")
+	assert.Nil(os.WriteFile(config, []byte(fmt.Sprintf(`{
+		"log_level": "info",
+		"sinks": [
+			{"type": "file", "path": %q, "level": "debug", "format": "json"},
+			{"type": "syslog", "addr": %q, "level": "error", "tag": "sink_test"}
+		]
+	}`, logFile, collector.LocalAddr().String())), 0600))
+	assert.Nil(logger.InitLogger(config))
+	defer func() {
+		assert.Nil(logger.InitLogger("../config/log_config.json"))
+	}()
+
+	logger.Debug("debug only in file")
+	logger.Error("error everywhere")
+
+	buf := make([]byte, 2048)
+	_ = collector.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := collector.ReadFrom(buf)
+	assert.Nil(err)
+	datagram := string(buf[:n])
+	assert.True(strings.HasPrefix(datagram, "<131>"), datagram) // local0.err
+	assert.Contains(datagram, "sink_test[")
+	assert.Contains(datagram, "error everywhere")
+
+	data, err := os.ReadFile(logFile)
+	assert.Nil(err)
+	assert.Contains(string(data), `"msg":"debug only in file"`)
+	assert.Contains(string(data), `"msg":"error everywhere"`)
+}
+
+func TestLoggerRuntimeLevel(t *testing.T) {
+	assert := require.New(t)
+	var buf bytes.Buffer
+	l, err := logger.NewLogger(&buf, logger.Config{LogLevel: "info"})
+	assert.Nil(err)
+
+	t.Run("override level", func(t *testing.T) {
+		buf.Reset()
+		l.Debug("hidden")
+		logger.SetLevel(slog.LevelDebug)
+		l.Debug("shown")
+		logger.ResetLevel()
+		l.Debug("hidden again")
+		assert.NotContains(buf.String(), "hidden")
+		assert.Contains(buf.String(), "shown")
+	})
+
+	t.Run("debug single username", func(t *testing.T) {
+		buf.Reset()
+		logger.EnableDebugFor("username", "alice")
+		defer logger.DisableDebugFor("username", "alice")
+
+		l.Debugw("per call field", "username", "alice")
+		l.With("session_id", 3, "username", "alice").Debug("child field")
+		l.With("username", "bob").Debug("other user")
+		assert.Contains(buf.String(), "per call field")
+		assert.Contains(buf.String(), "child field")
+		assert.NotContains(buf.String(), "other user")
+		assert.Equal([]string{"alice"}, logger.DebugTargets()["username"])
+	})
+}
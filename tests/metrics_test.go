@@ -0,0 +1,58 @@
+package tests
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"luxor.tech/tcp_msg_processing_test/internal/client"
+	"luxor.tech/tcp_msg_processing_test/internal/server"
+	"luxor.tech/tcp_msg_processing_test/internal/servertest"
+	"luxor.tech/tcp_msg_processing_test/pkg/logger"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	assert := require.New(t)
+	assert.Nil(logger.InitLogger("../config/log_config.json"))
+
+	srv := servertest.NewServer(t, server.DefaultConfig())
+	username := "metrics_user"
+	c := client.NewClient(srv.Addr, username, time.Second, time.Minute)
+	assert.Nil(c.Connect())
+	defer c.Close()
+	_, err := c.Submit(1, "nonce", strings.Repeat("0", 64), false) // not authorized yet
+	assert.Nil(err)
+	assert.Nil(c.Authorize())
+	srv.DistributeTo(username)
+	job, err := c.ReceiveRequest()
+	assert.Nil(err)
+	task, err := job.Job()
+	assert.Nil(err)
+	clientNonce, result := c.CalculateResult(task)
+	resp, err := c.Submit(task.JobID, clientNonce, result, false)
+	assert.Nil(err)
+	assert.True(resp.Result)
+
+	recorder := httptest.NewRecorder()
+	promhttp.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(recorder.Body)
+	for _, series := range []string{
+		`tcpmsg_server_shares_total{reason="Not authorized",result="rejected"}`,
+		`tcpmsg_server_shares_total{reason="",result="accepted"}`,
+		`tcpmsg_server_authorize_total{result="success"}`,
+		`tcpmsg_server_connections_active`,
+		`tcpmsg_server_submit_duration_seconds_count`,
+		`tcpmsg_server_job_broadcast_duration_seconds_count`,
+		`tcpmsg_client_hashes_total`,
+		`tcpmsg_client_round_trip_seconds_count{method="submit"}`,
+		`tcpmsg_client_shares_total{result="accepted"}`,
+	} {
+		assert.Contains(string(body), series)
+	}
+}
@@ -0,0 +1,29 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+
+	rds_db "luxor.tech/tcp_msg_processing_test/rds-db"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	assert := require.New(t)
+	migrations, err := rds_db.LoadMigrations()
+	assert.Nil(err)
+	assert.NotEmpty(migrations)
+
+	assert.Equal(1, migrations[0].Version)
+	assert.Equal("create_submissions", migrations[0].Name)
+	assert.Contains(migrations[0].Up, "CREATE TABLE IF NOT EXISTS submissions")
+	assert.True(strings.Contains(migrations[0].Down, "DROP TABLE"))
+	names := make([]string, 0, len(migrations))
+	for i := 1; i < len(migrations); i++ {
+		assert.Less(migrations[i-1].Version, migrations[i].Version)
+		assert.NotEmpty(migrations[i].Up)
+		names = append(names, migrations[i].Name)
+	}
+	assert.Contains(names, "rollup_late_submissions")
+}
@@ -0,0 +1,71 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"luxor.tech/tcp_msg_processing_test/internal/protocol"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProtocolParams(t *testing.T) {
+	assert := require.New(t)
+	hex64 := strings.Repeat("ab", 32)
+
+	t.Run("submit", func(t *testing.T) {
+		var p protocol.SubmitParams
+		assert.Nil(protocol.Decode(json.RawMessage(`{"job_id":7,"client_nonce":"aZ09","result":"`+hex64+`"}`), &p))
+		assert.Equal(protocol.SubmitParams{JobID: 7, ClientNonce: "aZ09", Result: hex64}, p)
+
+		for raw, field := range map[string]string{
+			`{"job_id":1.9,"client_nonce":"n","result":"` + hex64 + `"}`:                "job_id",
+			`{"job_id":1e3,"client_nonce":"n","result":"` + hex64 + `"}`:                "job_id",
+			`{"job_id":-1,"client_nonce":"n","result":"` + hex64 + `"}`:                 "job_id",
+			`{"job_id":"1","client_nonce":"n","result":"` + hex64 + `"}`:                "job_id",
+			`{"job_id":1e400,"client_nonce":"n","result":"` + hex64 + `"}`:              "job_id",
+			`{"client_nonce":"n","result":"` + hex64 + `"}`:                             "job_id",
+			`{"job_id":1,"client_nonce":"","result":"` + hex64 + `"}`:                   "client_nonce",
+			`{"job_id":1,"client_nonce":"n-1","result":"` + hex64 + `"}`:                "client_nonce",
+			`{"job_id":1,"client_nonce":5,"result":"` + hex64 + `"}`:                    "client_nonce",
+			`{"job_id":1,"client_nonce":"` + strings.Repeat("n", 65) + `"}`:             "client_nonce",
+			`{"job_id":1,"client_nonce":"n","result":"abc"}`:                            "result",
+			`{"job_id":1,"client_nonce":"n","result":"` + strings.ToUpper(hex64) + `"}`: "result",
+			`[1,2]`: "params",
+		} {
+			var p protocol.SubmitParams
+			err := protocol.Decode(json.RawMessage(raw), &p)
+			var invalid *protocol.InvalidParamsError
+			assert.True(errors.As(err, &invalid), raw)
+			assert.Equal(field, invalid.Field, raw)
+			assert.True(strings.HasPrefix(err.Error(), "Invalid parameters: "+field), raw)
+		}
+
+		assert.Equal(protocol.ErrMissingParams, protocol.Decode(nil, &p))
+		assert.Equal(protocol.ErrMissingParams, protocol.Decode(json.RawMessage(" null "), &p))
+	})
+
+	t.Run("authorize", func(t *testing.T) {
+		var p protocol.AuthorizeParams
+		for _, username := range []string{"acct.worker_1-a", "a b", "user@pool/1", strings.Repeat("u", 64)} {
+			assert.Nil(protocol.Decode(protocol.Encode(&protocol.AuthorizeParams{Username: username}), &p), username)
+		}
+		for _, raw := range []string{`{"username":5}`, `{"username":""}`, `{}`,
+			`{"username":"` + strings.Repeat("u", 65) + `"}`} {
+			assert.NotNil(protocol.Decode(json.RawMessage(raw), &p), raw)
+		}
+	})
+
+	t.Run("job round trip", func(t *testing.T) {
+		job := &protocol.JobParams{JobID: 3, ServerNonce: "123456789", Extranonce: "0000002a", CleanJobs: true}
+		var decoded protocol.JobParams
+		assert.Nil(protocol.Decode(protocol.Encode(job), &decoded))
+		assert.Equal(*job, decoded)
+		assert.NotNil(protocol.Decode(json.RawMessage(`{"job_id":0,"server_nonce":"1"}`), &decoded))
+		assert.NotNil(protocol.Decode(json.RawMessage(`{"job_id":1,"server_nonce":"1","extranonce":"x-1"}`), &decoded))
+		assert.Equal(protocol.Result("1234", "", "ab"), protocol.Result("12", "34", "ab"))
+		assert.Equal(protocol.Result("123456789", "0000002a", "ab"), job.Result("ab"))
+	})
+}
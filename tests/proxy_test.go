@@ -0,0 +1,147 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"luxor.tech/tcp_msg_processing_test/internal/client"
+	"luxor.tech/tcp_msg_processing_test/internal/protocol"
+	"luxor.tech/tcp_msg_processing_test/internal/proxy"
+	"luxor.tech/tcp_msg_processing_test/internal/server"
+	"luxor.tech/tcp_msg_processing_test/internal/servertest"
+	"luxor.tech/tcp_msg_processing_test/pkg/clock"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProxy(t *testing.T) {
+	assert := require.New(t)
+
+	cfg := server.DefaultConfig()
+	cfg.PingInterval, cfg.AuthTimeout = 0, 0
+	upstream := servertest.NewServer(t, cfg)
+
+	proxyConfig := proxy.DefaultConfig()
+	proxyConfig.Upstream, proxyConfig.Username = upstream.Addr, "proxy"
+	proxyConfig.ReconnectDelay = time.Millisecond * 10
+	assert.Nil(proxyConfig.Validate())
+	p := proxy.NewProxy(proxyConfig)
+	pace := clock.NewFake(servertest.Epoch)
+	p.SetClock(pace)
+	downstreamConfig := cfg
+	downstreamConfig.JobInterval, downstreamConfig.JobMinInterval, downstreamConfig.JobDebounce = 0, 0, 0
+	downstream := servertest.NewServerWithJobs(t, downstreamConfig, p)
+	_, err := p.NextJob()
+	assert.ErrorIs(err, proxy.ErrNoUpstreamJob)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go p.Run(ctx)
+	upstream.WaitSession(t, "proxy", nil)
+	assert.Eventually(p.Connected, time.Second*5, time.Millisecond)
+
+	miners := make(map[string]*client.Client)
+	for _, username := range []string{"miner1", "miner2"} {
+		c := client.NewClient(downstream.Addr, username, time.Second, time.Minute)
+		t.Cleanup(c.Close)
+		assert.Nil(c.Connect())
+		assert.Nil(c.Authorize())
+		downstream.WaitSession(t, username, nil)
+		miners[username] = c
+	}
+	// the upstream job is re-issued downstream as soon as it arrives
+	assert.Equal(1, upstream.Tick())
+	upstreamJob := upstream.Job(t, "proxy")
+	jobs := make(map[string]client.Task)
+	for username, c := range miners {
+		req, err := c.ReceiveRequest()
+		assert.Nil(err)
+		job, err := req.Job()
+		assert.Nil(err)
+		assert.Equal(upstreamJob.ServerNonce, job.ServerNonce)
+		assert.Len(job.Extranonce, len(upstreamJob.Extranonce)+cfg.ExtranonceSize*2)
+		assert.Equal(upstreamJob.Extranonce, job.Extranonce[:len(upstreamJob.Extranonce)])
+		assert.True(job.CleanJobs)
+		jobs[username] = job
+	}
+	assert.NotEqual(jobs["miner1"].Extranonce, jobs["miner2"].Extranonce)
+
+	submit := func(username string) {
+		c, job := miners[username], jobs[username]
+		clientNonce, result := c.CalculateResult(job)
+		resp, err := c.Submit(job.JobID, clientNonce, result, false)
+		assert.Nil(err)
+		assert.True(resp.Result, resp.Error)
+	}
+	users := func() map[string]proxy.UserStats {
+		stats := make(map[string]proxy.UserStats)
+		for _, user := range p.Users() {
+			stats[user.Username] = user
+		}
+		return stats
+	}
+
+	t.Run("forward", func(t *testing.T) {
+		submit("miner1")
+		assert.Eventually(func() bool {
+			return users()["miner1"].UpstreamAccepted == 1
+		}, time.Second*5, time.Millisecond)
+		assert.Equal(int64(1), users()["miner1"].Forwarded)
+		assert.Equal(int64(1), upstream.WaitSession(t, "proxy", nil).Accepted)
+	})
+
+	t.Run("forward interval", func(t *testing.T) {
+		// valid downstream, held back until ForwardInterval after the previous forwarded share
+		submit("miner2")
+		waitWaiters(t, pace, 1)
+		miner2 := users()["miner2"]
+		assert.Equal(int64(1), miner2.Accepted)
+		assert.Zero(miner2.Forwarded)
+
+		upstream.Clock.Advance(time.Second)
+		pace.Advance(proxyConfig.ForwardInterval)
+		assert.Eventually(func() bool {
+			return users()["miner2"].UpstreamAccepted == 1
+		}, time.Second*5, time.Millisecond)
+		assert.Equal(int64(2), upstream.WaitSession(t, "proxy", nil).Accepted)
+	})
+
+	t.Run("reconnect", func(t *testing.T) {
+		// a share still queued when the upstream session is lost goes with it
+		downstream.Clock.Advance(time.Second)
+		submit("miner1")
+		waitWaiters(t, pace, 1)
+
+		previous := upstream.WaitSession(t, "proxy", nil)
+		assert.True(upstream.Kick(previous.ID))
+		upstream.WaitSession(t, "proxy", func(info server.SessionInfo) bool { return info.ID != previous.ID })
+		assert.Equal(1, upstream.Tick())
+		// the new upstream session gets another extranonce, so downstream starts over with a clean job
+		for username, c := range miners {
+			req, err := c.ReceiveRequest()
+			assert.Nil(err)
+			job, err := req.Job()
+			assert.Nil(err)
+			assert.True(job.CleanJobs)
+			assert.NotEqual(jobs[username].Extranonce, job.Extranonce)
+			jobs[username] = job
+		}
+		pace.Advance(proxyConfig.ForwardInterval) // would release the dropped share
+		downstream.Clock.Advance(time.Second)
+		submit("miner1")
+		assert.Eventually(func() bool {
+			return users()["miner1"].UpstreamAccepted == 2
+		}, time.Second*5, time.Millisecond)
+		miner1 := users()["miner1"]
+		assert.Equal(int64(2), miner1.Forwarded)
+		assert.Zero(miner1.UpstreamRejected)
+		assert.Equal(int64(1), upstream.WaitSession(t, "proxy", nil).Accepted)
+	})
+
+	t.Run("validate", func(t *testing.T) {
+		invalid := proxyConfig
+		invalid.ForwardZeros = protocol.ResultLength + 1
+		assert.ErrorContains(invalid.Validate(), "forward zeros")
+	})
+}
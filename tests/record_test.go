@@ -0,0 +1,150 @@
+package tests
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"luxor.tech/tcp_msg_processing_test/internal/client"
+	"luxor.tech/tcp_msg_processing_test/internal/record"
+	"luxor.tech/tcp_msg_processing_test/internal/server"
+	"luxor.tech/tcp_msg_processing_test/internal/servertest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordReplay(t *testing.T) {
+	assert := require.New(t)
+
+	assert.ErrorIs(servertest.NewServer(t, server.DefaultConfig()).Record("rec"), server.ErrRecordingDisabled)
+
+	cfg := server.DefaultConfig()
+	cfg.RecordDir = t.TempDir()
+	ts := servertest.NewServer(t, cfg)
+	assert.Nil(ts.Record("rec"))
+	assert.Equal([]string{"rec"}, ts.Recordings())
+
+	// one valid share, one with a wrong result
+	c := client.NewClient(ts.Addr, "rec", time.Second, time.Minute)
+	assert.Nil(c.Connect())
+	assert.Nil(c.Authorize())
+	ts.WaitSession(t, "rec", nil)
+	ts.Tick()
+	_, err := c.ReceiveRequest()
+	assert.Nil(err)
+	job := ts.Job(t, "rec")
+	clientNonce, result := c.CalculateResult(job)
+	resp, err := c.Submit(job.JobID, clientNonce, result, false)
+	assert.Nil(err)
+	assert.True(resp.Result)
+	ts.Clock.Advance(2 * time.Second)
+	resp, err = c.Submit(job.JobID, "other", result, false)
+	assert.Nil(err)
+	assert.Equal("Invalid result", resp.Error)
+	c.Close()
+
+	paths, err := filepath.Glob(filepath.Join(cfg.RecordDir, "rec-*.jsonl"))
+	assert.Nil(err)
+	assert.Len(paths, 1)
+	var rec *record.Recording
+	var checks []record.Check
+	assert.Eventually(func() bool {
+		rec, err = record.ReadFile(paths[0])
+		assert.Nil(err)
+		checks = record.Verify(rec)
+		return len(checks) == 2 && checks[1].Answered
+	}, 2*time.Second, 10*time.Millisecond)
+	assert.Equal("rec", rec.Header.Username)
+	assert.Equal(record.In, rec.Frames[0].Dir)
+	assert.Contains(rec.Frames[0].Data, `"authorize"`)
+
+	assert.True(checks[0].Valid())
+	assert.True(checks[0].Accepted)
+	assert.Equal(job.ServerNonce, checks[0].ServerNonce)
+	assert.Equal(job.Extranonce, checks[0].Extranonce)
+	assert.False(checks[1].Valid())
+	assert.False(checks[1].Suspect())
+	assert.Equal("Invalid result", checks[1].Error)
+
+	// a valid share answered "Invalid result" is what the tool is for
+	tampered := *rec
+	tampered.Frames = append([]record.Frame(nil), rec.Frames...)
+	for i, frame := range tampered.Frames {
+		if frame.Dir == record.Out && strings.Contains(frame.Data, `"result":true`) {
+			tampered.Frames[i].Data = strings.Replace(frame.Data, `"result":true,"error":""`, `"result":false,"error":"Invalid result"`, 1)
+		}
+	}
+	suspect := record.Verify(&tampered)
+	assert.True(suspect[0].Suspect())
+	assert.Equal("Invalid result", suspect[0].Error)
+
+	t.Run("verbatim", func(t *testing.T) {
+		assert := require.New(t)
+		target := servertest.NewServer(t, server.DefaultConfig())
+		conn, err := net.Dial("tcp", target.Addr)
+		assert.Nil(err)
+		defer conn.Close()
+		live, err := record.Replay(context.Background(), conn, rec, record.ReplayOptions{Wait: 2 * time.Second})
+		assert.Nil(err)
+		// no job was sent by the new server
+		replayed := record.Verify(live)
+		assert.Len(replayed, 2)
+		assert.Equal("Task does not exist", replayed[0].Error)
+		assert.Equal("Task does not exist", replayed[1].Error)
+	})
+
+	t.Run("rewrite", func(t *testing.T) {
+		assert := require.New(t)
+		target := servertest.NewServer(t, server.DefaultConfig())
+		conn, err := net.Dial("tcp", target.Addr)
+		assert.Nil(err)
+		defer conn.Close()
+		go func() {
+			for target.Tick() == 0 {
+				time.Sleep(10 * time.Millisecond)
+			}
+		}()
+		live, err := record.Replay(context.Background(), conn, rec, record.ReplayOptions{Rewrite: true, Wait: 2 * time.Second})
+		assert.Nil(err)
+		replayed := record.Verify(live)
+		assert.Len(replayed, 2)
+		assert.True(replayed[0].Accepted)
+		assert.True(replayed[0].Valid())
+		// back to back on a stopped clock
+		assert.Equal("Submission too frequent", replayed[1].Error)
+	})
+
+	t.Run("rewrite keeps invalid shares", func(t *testing.T) {
+		assert := require.New(t)
+		// the share with a wrong result alone
+		invalid := *rec
+		invalid.Frames = nil
+		submits := 0
+		for _, frame := range rec.Frames {
+			if frame.Dir == record.In && strings.Contains(frame.Data, `"submit"`) {
+				if submits++; submits == 1 {
+					continue
+				}
+			}
+			invalid.Frames = append(invalid.Frames, frame)
+		}
+		target := servertest.NewServer(t, server.DefaultConfig())
+		conn, err := net.Dial("tcp", target.Addr)
+		assert.Nil(err)
+		defer conn.Close()
+		go func() {
+			for target.Tick() == 0 {
+				time.Sleep(10 * time.Millisecond)
+			}
+		}()
+		live, err := record.Replay(context.Background(), conn, &invalid, record.ReplayOptions{Rewrite: true, Wait: 2 * time.Second})
+		assert.Nil(err)
+		replayed := record.Verify(live)
+		assert.Len(replayed, 1)
+		assert.False(replayed[0].Valid())
+		assert.Equal("Invalid result", replayed[0].Error)
+	})
+}
@@ -0,0 +1,60 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"luxor.tech/tcp_msg_processing_test/internal/rollup"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRollupPlan(t *testing.T) {
+	assert := require.New(t)
+	day := time.Hour * 24
+	now := time.Date(2024, 5, 10, 13, 25, 0, 0, time.UTC)
+	cfg := rollup.Config{Lookback: time.Hour * 2, MinuteRetention: day * 7, HourlyRetention: day * 90}
+
+	t.Run("first run", func(t *testing.T) {
+		earliest := time.Date(2024, 5, 9, 22, 41, 0, 0, time.UTC)
+		plan := rollup.MakePlan(now, rollup.State{}, rollup.State{}, earliest, cfg)
+		assert.Equal(time.Date(2024, 5, 9, 22, 0, 0, 0, time.UTC), plan.HourlyFrom)
+		assert.Equal(time.Date(2024, 5, 10, 13, 0, 0, 0, time.UTC), plan.HourlyTo)
+		assert.Equal(time.Date(2024, 5, 9, 0, 0, 0, 0, time.UTC), plan.DailyFrom)
+		assert.Equal(time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC), plan.DailyTo)
+		assert.Equal(time.Date(2024, 5, 3, 13, 0, 0, 0, time.UTC), plan.MinuteCutoff)
+		assert.Equal(time.Date(2024, 2, 10, 0, 0, 0, 0, time.UTC), plan.HourlyCutoff)
+	})
+
+	t.Run("no data", func(t *testing.T) {
+		plan := rollup.MakePlan(now, rollup.State{}, rollup.State{}, time.Time{}, cfg)
+		assert.Equal(plan.HourlyTo, plan.HourlyFrom)
+	})
+
+	t.Run("incremental run recomputes lookback", func(t *testing.T) {
+		hourly := rollup.State{LastWindow: time.Date(2024, 5, 10, 12, 0, 0, 0, time.UTC)}
+		daily := rollup.State{LastWindow: time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)}
+		plan := rollup.MakePlan(now, hourly, daily, time.Time{}, cfg)
+		assert.Equal(time.Date(2024, 5, 10, 10, 0, 0, 0, time.UTC), plan.HourlyFrom)
+		assert.Equal(time.Date(2024, 5, 10, 13, 0, 0, 0, time.UTC), plan.HourlyTo)
+		assert.Equal(time.Date(2024, 5, 9, 0, 0, 0, 0, time.UTC), plan.DailyFrom)
+		assert.Equal(time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC), plan.DailyTo)
+	})
+
+	t.Run("never recompute pruned windows", func(t *testing.T) {
+		pruned := time.Date(2024, 5, 10, 11, 0, 0, 0, time.UTC)
+		hourly := rollup.State{LastWindow: time.Date(2024, 5, 10, 12, 0, 0, 0, time.UTC), PrunedBefore: pruned}
+		plan := rollup.MakePlan(now, hourly, rollup.State{}, time.Time{}, cfg)
+		assert.Equal(pruned, plan.HourlyFrom)
+		assert.Equal(pruned, plan.MinuteCutoff) // retention never goes backwards
+	})
+
+	t.Run("prune only rolled up rows", func(t *testing.T) {
+		short := rollup.Config{MinuteRetention: time.Minute, HourlyRetention: time.Hour}
+		hourly := rollup.State{LastWindow: time.Date(2024, 5, 10, 9, 0, 0, 0, time.UTC)}
+		daily := rollup.State{LastWindow: time.Date(2024, 5, 8, 0, 0, 0, 0, time.UTC)}
+		plan := rollup.MakePlan(now, hourly, daily, time.Time{}, short)
+		assert.Equal(plan.HourlyTo, plan.MinuteCutoff)
+		assert.Equal(plan.DailyTo, plan.HourlyCutoff)
+	})
+}
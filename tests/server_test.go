@@ -12,47 +12,22 @@ import (
 
 	"luxor.tech/tcp_msg_processing_test/internal/client"
 	"luxor.tech/tcp_msg_processing_test/internal/server"
-	"luxor.tech/tcp_msg_processing_test/pkg/logger"
-	rds_db "luxor.tech/tcp_msg_processing_test/rds-db"
+	"luxor.tech/tcp_msg_processing_test/internal/servertest"
 
 	"github.com/stretchr/testify/require"
 )
 
-var once sync.Once
-var testServer *server.Server
-
-func InitServer() {
-	once.Do(func() {
-		err := logger.InitLogger("../config/log_config.json")
-		if err != nil {
-			panic("Failed to initialize logger: " + err.Error())
-		}
-		rds_db.GetDb()
-
-		go func() {
-			testServer = server.NewServer()
-			err := testServer.Start(":8888")
-			if err != nil {
-				panic(err)
-			}
-		}()
-	})
-}
-
 func TestServer(t *testing.T) {
-
-	// start server
-	InitServer()
+	ts := servertest.NewServer(t, server.DefaultConfig())
 	assert := require.New(t)
 
 	username := "single-cli"
-	serverAddr := "localhost:8888"
-	c := client.NewClient(serverAddr, username, time.Second, time.Minute)
+	c := client.NewClient(ts.Addr, username, time.Second, time.Minute)
 	err := c.Connect()
 	assert.Nil(err)
 
 	t.Run("not authorize", func(t *testing.T) {
-		resp, err := c.Submit(1, "cliNonce", "calcuRes", true)
+		resp, err := c.Submit(1, "cliNonce", strings.Repeat("0", 64), true)
 		assert.Nil(err)
 		assert.NotNil(resp)
 		assert.Equal(false, resp.Result)
@@ -62,7 +37,7 @@ func TestServer(t *testing.T) {
 	t.Run("not exist job_id", func(t *testing.T) {
 		err := c.Authorize()
 		assert.Nil(err)
-		resp, err := c.Submit(1000, "cliNonce", "calcuRes", true)
+		resp, err := c.Submit(1000, "cliNonce", strings.Repeat("0", 64), true)
 		assert.Nil(err)
 		assert.NotNil(resp)
 		assert.Equal(false, resp.Result)
@@ -72,14 +47,13 @@ func TestServer(t *testing.T) {
 	t.Run("duplicate clientNonce", func(t *testing.T) {
 		err := c.Authorize()
 		assert.Nil(err)
-		testServer.DistributionToForTest(username) // distribute task
+		ts.Tick() // distribute task
 		job, _ := c.ReceiveRequest()
 		tb, _ := json.Marshal(job.Params)
 		var taskInfo client.Task
 		_ = json.Unmarshal(tb, &taskInfo)
 		jobID := taskInfo.JobID
-		serverNonce := taskInfo.ServerNonce
-		clientNonce, result := c.CalculateResult(serverNonce)
+		clientNonce, result := c.CalculateResult(taskInfo)
 		_, _ = c.Submit(jobID, clientNonce, result, true)
 		resp, err := c.Submit(jobID, clientNonce, result, true) // double
 		assert.Nil(err)
@@ -92,23 +66,21 @@ func TestServer(t *testing.T) {
 		err := c.Authorize()
 		assert.Nil(err)
 		// once
-		testServer.DistributionToForTest(username) // distribute task
+		ts.Tick() // distribute task
 		job, _ := c.ReceiveRequest()
 		tb, _ := json.Marshal(job.Params)
 		var taskInfo client.Task
 		_ = json.Unmarshal(tb, &taskInfo)
 		jobID := taskInfo.JobID
-		serverNonce := taskInfo.ServerNonce
-		clientNonce, result := c.CalculateResult(serverNonce)
+		clientNonce, result := c.CalculateResult(taskInfo)
 		_, _ = c.Submit(jobID, clientNonce, result, false)
 		// twice
-		testServer.DistributionToForTest(username) // distribute task
+		ts.Tick() // distribute task
 		job, _ = c.ReceiveRequest()
 		tb, _ = json.Marshal(job.Params)
 		_ = json.Unmarshal(tb, &taskInfo)
 		jobID = taskInfo.JobID
-		serverNonce = taskInfo.ServerNonce
-		clientNonce, result = c.CalculateResult(serverNonce)
+		clientNonce, result = c.CalculateResult(taskInfo)
 		resp, err := c.Submit(jobID, clientNonce, result, false) // double
 		assert.Nil(err)
 		assert.NotNil(resp)
@@ -119,14 +91,13 @@ func TestServer(t *testing.T) {
 	t.Run("incorrect job_id", func(t *testing.T) {
 		err := c.Authorize()
 		assert.Nil(err)
-		testServer.DistributionToForTest(username) // distribute task
+		ts.Tick() // distribute task
 		job, _ := c.ReceiveRequest()
 		tb, _ := json.Marshal(job.Params)
 		var taskInfo client.Task
 		_ = json.Unmarshal(tb, &taskInfo)
 		jobID := taskInfo.JobID
-		serverNonce := taskInfo.ServerNonce
-		clientNonce, result := c.CalculateResult(serverNonce)
+		clientNonce, result := c.CalculateResult(taskInfo)
 		resp, err := c.Submit(jobID+1, clientNonce, result, true)
 		assert.Nil(err)
 		assert.NotNil(resp)
@@ -136,8 +107,8 @@ func TestServer(t *testing.T) {
 }
 
 func TestConcurrency(t *testing.T) {
-	InitServer()
-	serverAddr := "localhost:8888"
+	ts := servertest.NewServer(t, server.DefaultConfig())
+	serverAddr := ts.Addr
 	assert := require.New(t)
 
 	t.Run("Authorize concurrency", func(t *testing.T) {
@@ -190,7 +161,7 @@ func TestConcurrency(t *testing.T) {
 		}
 		// send tasks
 		authorizeWg.Wait()
-		testServer.StartTaskDistribution(time.Millisecond, 1)
+		ts.Tick()
 
 		wg.Wait()
 	})
@@ -0,0 +1,90 @@
+package tests
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"luxor.tech/tcp_msg_processing_test/internal/client"
+	"luxor.tech/tcp_msg_processing_test/internal/server"
+	"luxor.tech/tcp_msg_processing_test/internal/servertest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerTest(t *testing.T) {
+	assert := require.New(t)
+
+	t.Run("client over tcp", func(t *testing.T) {
+		ts := servertest.NewServer(t, server.DefaultConfig())
+		c := client.NewClient(ts.Addr, "harness", time.Second, time.Minute)
+		defer c.Close()
+		assert.Nil(c.Connect())
+		assert.Nil(c.Authorize())
+		ts.WaitSession(t, "harness", nil)
+
+		assert.Equal(1, ts.Tick())
+		req, err := c.ReceiveRequest()
+		assert.Nil(err)
+		assert.Equal("job", req.Method)
+		job := ts.Job(t, "harness")
+
+		clientNonce, result := c.CalculateResult(job)
+		resp, err := c.Submit(job.JobID, clientNonce, result, false)
+		assert.Nil(err)
+		assert.True(resp.Result)
+		resp, err = c.Submit(job.JobID, clientNonce, result, false)
+		assert.Nil(err)
+		assert.Equal("Duplicate submission", resp.Error)
+
+		info := ts.WaitSession(t, "harness", nil)
+		assert.Equal(int64(1), info.Accepted)
+		assert.Equal(int64(1), info.Rejected)
+		assert.Equal(1, ts.Store.Submissions("harness"))
+		ts.FlushRejects()
+		assert.Equal(1, ts.Store.Rejections("harness", "Duplicate submission"))
+	})
+
+	t.Run("pipe", func(t *testing.T) {
+		ts := servertest.NewServer(t, server.DefaultConfig())
+		conn := ts.Pipe()
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		readResponse := func() server.Response {
+			line, err := reader.ReadBytes('\n')
+			assert.Nil(err)
+			var resp server.Response
+			assert.Nil(json.Unmarshal(line, &resp))
+			return resp
+		}
+
+		_, err := conn.Write([]byte(`{"id":1,"method":"authorize","params":{"username":"piped"}}` + "\n"))
+		assert.Nil(err)
+		assert.True(readResponse().Result)
+		ts.WaitSession(t, "piped", nil)
+
+		go ts.Tick() // pipes are unbuffered, the job is read below
+		line, err := reader.ReadBytes('\n')
+		assert.Nil(err)
+		assert.Contains(string(line), `"method":"job"`)
+		job := ts.Job(t, "piped")
+
+		_, err = fmt.Fprintf(conn, `{"id":2,"method":"submit","params":{"job_id":%d,"client_nonce":"n","result":"%s"}}`+"\n", job.JobID, strings.Repeat("0", 64))
+		assert.Nil(err)
+		assert.Equal("Invalid result", readResponse().Error)
+	})
+
+	t.Run("close disconnects clients", func(t *testing.T) {
+		ts := servertest.NewServer(t, server.DefaultConfig())
+		c := client.NewClient(ts.Addr, "closing", time.Second, time.Minute)
+		defer c.Close()
+		assert.Nil(c.Connect())
+		assert.Nil(c.Authorize())
+		assert.Nil(ts.Close())
+		_, err := c.ReceiveRequest()
+		assert.NotNil(err)
+	})
+}
@@ -0,0 +1,126 @@
+package tests
+
+import (
+	"database/sql/driver"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"luxor.tech/tcp_msg_processing_test/internal/client"
+	"luxor.tech/tcp_msg_processing_test/internal/server"
+	"luxor.tech/tcp_msg_processing_test/internal/servertest"
+	"luxor.tech/tcp_msg_processing_test/internal/spool"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpool(t *testing.T) {
+	assert := require.New(t)
+	path := filepath.Join(t.TempDir(), "spool", "submissions.spool")
+	minute := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	s, err := spool.Open(path, 0)
+	assert.Nil(err)
+	for _, username := range []string{"a", "b", "c"} {
+		assert.Nil(s.Append(spool.NewRecord(username, minute, 1)))
+	}
+	assert.Equal(3, s.Len())
+
+	t.Run("replay stops at first failure", func(t *testing.T) {
+		var applied []string
+		replayed, err := s.Replay(func(rec spool.Record) error {
+			if rec.Username == "b" {
+				return errors.New("db down")
+			}
+			applied = append(applied, rec.Username)
+			return nil
+		})
+		assert.NotNil(err)
+		assert.Equal(1, replayed)
+		assert.Equal([]string{"a"}, applied)
+		assert.Equal(2, s.Len())
+	})
+
+	t.Run("survives reopen and torn tail", func(t *testing.T) {
+		assert.Nil(s.Close())
+		file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+		assert.Nil(err)
+		_, _ = file.WriteString(`{"id":"torn","user`)
+		file.Close()
+
+		s, err = spool.Open(path, 0)
+		assert.Nil(err)
+		assert.Equal(2, s.Len())
+
+		var ids []string
+		replayed, err := s.Replay(func(rec spool.Record) error {
+			ids = append(ids, rec.ID)
+			assert.Equal(minute, rec.Minute)
+			return nil
+		})
+		assert.Nil(err)
+		assert.Equal(2, replayed)
+		assert.Len(ids, 2)
+		assert.NotEqual(ids[0], ids[1])
+		assert.Equal(0, s.Len())
+	})
+
+	t.Run("size limit", func(t *testing.T) {
+		limited, err := spool.Open(filepath.Join(t.TempDir(), "limited.spool"), 150)
+		assert.Nil(err)
+		defer limited.Close()
+		assert.Nil(limited.Append(spool.NewRecord("a", minute, 1)))
+		assert.ErrorIs(limited.Append(spool.NewRecord("b", minute, 1)), spool.ErrFull)
+		assert.Equal(1, limited.Len())
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		closed, err := spool.Open(filepath.Join(t.TempDir(), "closed.spool"), 0)
+		assert.Nil(err)
+		assert.Nil(closed.Append(spool.NewRecord("a", minute, 1)))
+		assert.Nil(closed.Close())
+		assert.Nil(closed.Close())
+		assert.ErrorIs(closed.Append(spool.NewRecord("b", minute, 1)), spool.ErrClosed)
+		_, err = closed.Replay(func(spool.Record) error { return nil })
+		assert.ErrorIs(err, spool.ErrClosed)
+	})
+}
+
+func TestServerSpool(t *testing.T) {
+	assert := require.New(t)
+	cfg := server.DefaultConfig()
+	cfg.SpoolFile = filepath.Join(t.TempDir(), "submissions.spool")
+	cfg.SpoolReplayInterval = 0
+	ts := servertest.NewServer(t, cfg)
+
+	c := client.NewClient(ts.Addr, "spooled", time.Second, time.Minute)
+	defer c.Close()
+	assert.Nil(c.Connect())
+	assert.Nil(c.Authorize())
+	ts.WaitSession(t, "spooled", nil)
+	submit := func() {
+		assert.Equal(1, ts.Tick())
+		_, err := c.ReceiveRequest()
+		assert.Nil(err)
+		job := ts.Job(t, "spooled")
+		clientNonce, result := c.CalculateResult(job)
+		resp, err := c.Submit(job.JobID, clientNonce, result, false)
+		assert.Nil(err)
+		assert.True(resp.Result)
+		ts.Clock.Advance(time.Second)
+	}
+
+	// the write certainly did not run, the share is replayed once the database is back
+	ts.Store.Fail(driver.ErrBadConn)
+	submit()
+	// the write may have committed, replaying it could count the share twice
+	ts.Store.Fail(errors.New("read tcp: i/o timeout"))
+	submit()
+
+	ts.Store.Fail(nil)
+	assert.Equal(1, ts.ReplaySpool())
+	assert.Equal(0, ts.ReplaySpool())
+	assert.Equal(1, ts.Store.Submissions("spooled"))
+}
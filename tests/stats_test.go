@@ -0,0 +1,73 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"luxor.tech/tcp_msg_processing_test/internal/admin"
+	"luxor.tech/tcp_msg_processing_test/internal/server"
+	"luxor.tech/tcp_msg_processing_test/internal/stats"
+	rds_db "luxor.tech/tcp_msg_processing_test/rds-db"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatsParams(t *testing.T) {
+	assert := require.New(t)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("granularity", func(t *testing.T) {
+		g, err := stats.ParseGranularity("")
+		assert.Nil(err)
+		assert.Equal(stats.Hour, g)
+		g, err = stats.ParseGranularity("day")
+		assert.Nil(err)
+		assert.Equal(stats.Day, g)
+		_, err = stats.ParseGranularity("week")
+		assert.NotNil(err)
+	})
+
+	t.Run("window", func(t *testing.T) {
+		from, to, err := stats.ParseWindow("", "", now)
+		assert.Nil(err)
+		assert.Equal(now, to)
+		assert.Equal(now.Add(-time.Hour*24), from)
+
+		from, to, err = stats.ParseWindow("2024-04-01T00:00:00+02:00", "2024-04-02T00:00:00Z", now)
+		assert.Nil(err)
+		assert.Equal(time.Date(2024, 3, 31, 22, 0, 0, 0, time.UTC), from)
+		assert.Equal(time.Date(2024, 4, 2, 0, 0, 0, 0, time.UTC), to)
+
+		_, _, err = stats.ParseWindow("2024-04-02T00:00:00Z", "2024-04-01T00:00:00Z", now)
+		assert.NotNil(err)
+		_, _, err = stats.ParseWindow("yesterday", "", now)
+		assert.NotNil(err)
+	})
+
+	t.Run("acceptance ratio", func(t *testing.T) {
+		assert.Equal(float64(0), stats.AcceptanceRatio(0, 0))
+		assert.Equal(float64(1), stats.AcceptanceRatio(5, 0))
+		assert.Equal(0.75, stats.AcceptanceRatio(3, 1))
+	})
+
+	t.Run("admin rejects bad params", func(t *testing.T) {
+		api := admin.NewAdmin("", "secret", server.NewServer())
+		db, err := rds_db.GetDb()
+		assert.Nil(err)
+		api.EnableStats(stats.NewService(db))
+		srv := httptest.NewServer(api)
+		defer srv.Close()
+
+		for _, path := range []string{
+			"/stats/users/alice?granularity=week",
+			"/stats/top?n=0",
+			"/stats/totals?from=bad",
+			"/stats/rejections?to=bad",
+		} {
+			status, _, _ := adminRequest(t, http.MethodGet, srv.URL+path, "secret", "")
+			assert.Equal(http.StatusBadRequest, status, path)
+		}
+	})
+}
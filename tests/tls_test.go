@@ -0,0 +1,139 @@
+package tests
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"luxor.tech/tcp_msg_processing_test/internal/client"
+	"luxor.tech/tcp_msg_processing_test/internal/server"
+	"luxor.tech/tcp_msg_processing_test/internal/servertest"
+	"luxor.tech/tcp_msg_processing_test/pkg/logger"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// writeCert issue a certificate signed by ca (self-signed when ca is nil), returns cert/key file paths
+func writeCert(t *testing.T, dir, name string, serial int64, ca *testCA, isCA bool) (string, string, *testCA) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	parent, signer := tmpl, key
+	if ca != nil {
+		parent, signer = ca.cert, ca.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, signer)
+	require.Nil(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.Nil(t, err)
+
+	certFile := filepath.Join(dir, name+".crt")
+	keyFile := filepath.Join(dir, name+".key")
+	require.Nil(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.Nil(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+	cert, err := x509.ParseCertificate(der)
+	require.Nil(t, err)
+	return certFile, keyFile, &testCA{cert: cert, key: key}
+}
+
+func startTLSServer(t *testing.T, tlsConfig *server.TLSConfig) *servertest.Server {
+	require.Nil(t, logger.InitLogger("../config/log_config.json"))
+	cfg := server.DefaultConfig()
+	cfg.TLS = tlsConfig
+	return servertest.NewServer(t, cfg)
+}
+
+func TestTLS(t *testing.T) {
+	assert := require.New(t)
+	dir := t.TempDir()
+	caFile, _, ca := writeCert(t, dir, "ca", 1, nil, true)
+	certFile, keyFile, _ := writeCert(t, dir, "server", 2, ca, false)
+	clientCert, clientKey, _ := writeCert(t, dir, "client", 3, ca, false)
+
+	srv := startTLSServer(t, &server.TLSConfig{CertFile: certFile, KeyFile: keyFile})
+	addr := srv.Addr
+
+	t.Run("verified server", func(t *testing.T) {
+		c := client.NewClient(addr, "tls_user", time.Second, time.Minute)
+		c.SetTLS(&client.TLSConfig{CAFile: caFile})
+		defer c.Close()
+		assert.Nil(c.Connect())
+		assert.Nil(c.Authorize())
+	})
+
+	t.Run("unknown authority", func(t *testing.T) {
+		c := client.NewClient(addr, "tls_user", time.Second, time.Minute)
+		c.SetTLS(&client.TLSConfig{})
+		assert.NotNil(c.Connect())
+	})
+
+	t.Run("insecure skip verify", func(t *testing.T) {
+		c := client.NewClient(addr, "tls_user", time.Second, time.Minute)
+		c.SetTLS(&client.TLSConfig{InsecureSkipVerify: true})
+		defer c.Close()
+		assert.Nil(c.Connect())
+		assert.Nil(c.Authorize())
+	})
+
+	t.Run("reload certificate", func(t *testing.T) {
+		writeCert(t, dir, "server", 20, ca, false) // overwrite key pair with a new serial
+		assert.Nil(srv.ReloadTLS())
+
+		conn, err := tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true})
+		assert.Nil(err)
+		defer conn.Close()
+		assert.Nil(conn.Handshake())
+		assert.Equal(int64(20), conn.ConnectionState().PeerCertificates[0].SerialNumber.Int64())
+	})
+
+	mtlsAddr := startTLSServer(t, &server.TLSConfig{
+		CertFile:     certFile,
+		KeyFile:      keyFile,
+		ClientCAFile: caFile,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}).Addr
+
+	t.Run("client certificate", func(t *testing.T) {
+		c := client.NewClient(mtlsAddr, "mtls_user", time.Second, time.Minute)
+		c.SetTLS(&client.TLSConfig{CAFile: caFile, CertFile: clientCert, KeyFile: clientKey})
+		defer c.Close()
+		assert.Nil(c.Connect())
+		assert.Nil(c.Authorize())
+	})
+
+	t.Run("missing client certificate", func(t *testing.T) {
+		c := client.NewClient(mtlsAddr, "mtls_user", time.Second, time.Minute)
+		c.SetTLS(&client.TLSConfig{CAFile: caFile})
+		defer c.Close()
+		// TLS 1.3 reports the rejected client certificate on first read
+		if c.Connect() == nil {
+			assert.NotNil(c.Authorize())
+		}
+	})
+}
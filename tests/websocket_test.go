@@ -0,0 +1,67 @@
+package tests
+
+import (
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"luxor.tech/tcp_msg_processing_test/internal/client"
+	"luxor.tech/tcp_msg_processing_test/internal/server"
+	"luxor.tech/tcp_msg_processing_test/internal/servertest"
+	"luxor.tech/tcp_msg_processing_test/pkg/logger"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebSocket(t *testing.T) {
+	assert := require.New(t)
+	assert.Nil(logger.InitLogger("../config/log_config.json"))
+
+	srv := servertest.NewServer(t, server.DefaultConfig())
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(err)
+	go func() {
+		_ = srv.ServeWebSocket(ln)
+	}()
+	wsAddr := ln.Addr().String()
+
+	username := "ws_user"
+	c := client.NewClient("", username, time.Second, time.Minute)
+	c.SetWebSocket("ws://" + wsAddr + server.WebSocketPath)
+	assert.Nil(c.Connect())
+	defer c.Close()
+
+	t.Run("authorize", func(t *testing.T) {
+		assert.Nil(c.Authorize())
+	})
+
+	t.Run("job and submit", func(t *testing.T) {
+		srv.DistributionToForTest(username)
+		job, err := c.ReceiveRequest()
+		assert.Nil(err)
+		assert.Equal("job", job.Method)
+
+		task, err := job.Job()
+		assert.Nil(err)
+		clientNonce, result := c.CalculateResult(task)
+		resp, err := c.Submit(task.JobID, clientNonce, result, false)
+		assert.Nil(err)
+		assert.True(resp.Result, resp.Error)
+	})
+
+	t.Run("cross origin rejected", func(t *testing.T) {
+		header := http.Header{"Origin": []string{"http://evil.example"}}
+		_, resp, err := websocket.DefaultDialer.Dial("ws://"+wsAddr+server.WebSocketPath, header)
+		assert.NotNil(err)
+		assert.Equal(http.StatusForbidden, resp.StatusCode)
+	})
+
+	t.Run("closed with the server", func(t *testing.T) {
+		assert.Nil(srv.Close())
+		_, _, err := websocket.DefaultDialer.Dial("ws://"+wsAddr+server.WebSocketPath, nil)
+		assert.NotNil(err)
+	})
+}